@@ -0,0 +1,29 @@
+// LuaLight/api/lua_auxlib.go
+package api
+
+// AuxLib 辅助库接口，对应官方lauxlib（luaL_*系列函数）
+// 在基础栈操作之上封装参数检查、错误报告等常用逻辑，简化Go函数的编写
+// 注：加载（LoadString/DoFile）、注册表引用（Ref/Unref）、库注册（NewLib/SetFuncs）
+// 以及元表相关函数依赖表、函数调用等尚未实现的机制，暂不提供
+type AuxLib interface {
+	/* Error-report functions - 错误报告 */
+	Error2(format string, a ...interface{}) int // 按格式生成错误信息并抛出错误（luaL_error）
+	ArgError(arg int, extraMsg string) int      // 抛出“参数错误”（luaL_argerror）
+
+	/* Argument check functions - 参数检查 */
+	CheckStack2(sz int, msg string)               // 确保栈能容纳sz个新值，否则抛出ErrStackOverflow
+	ArgCheck(cond bool, arg int, extraMsg string) // cond为false时抛出参数错误
+	CheckAny(arg int)                             // 检查第arg个参数存在（任意类型，可以是nil）
+	CheckType(arg int, t LuaType)                 // 检查第arg个参数的类型为t
+	CheckInteger(arg int) int64                   // 检查第arg个参数可转换为整数并返回
+	CheckNumber(arg int) float64                  // 检查第arg个参数可转换为浮点数并返回
+	CheckString(arg int) string                   // 检查第arg个参数可转换为字符串并返回
+	OptInteger(arg int, d int64) int64            // 参数为无值/nil时返回默认值d，否则同CheckInteger
+	OptNumber(arg int, d float64) float64         // 参数为无值/nil时返回默认值d，否则同CheckNumber
+	OptString(arg int, d string) string           // 参数为无值/nil时返回默认值d，否则同CheckString
+
+	/* Other functions - 其他 */
+	TypeName2(idx int) string // 返回指定索引处值的类型名称
+	ToString2(idx int) string // 将任意值转换为字符串，压入栈顶并返回
+	Len2(idx int) int64       // 获取指定索引处值的长度（结果必须是整数）
+}
@@ -8,6 +8,8 @@ type CompareOp = int
 
 // LuaState 定义Lua虚拟机栈操作和类型交互的核心接口，对齐Lua官方C API语义
 type LuaState interface {
+	AuxLib // 辅助库（见lua_auxlib.go）
+
 	/* basic stack manipulation - 栈基础操作 */
 	GetTop() int             // 获取栈顶索引
 	AbsIndex(idx int) int    // 将相对索引转换为绝对索引
@@ -38,13 +40,29 @@ type LuaState interface {
 	ToNumberX(idx int) (float64, bool) // 转换为浮点数，返回值+是否成功
 	ToString(idx int) string           // 将指定索引值转换为字符串（失败返回""）
 	ToStringX(idx int) (string, bool)  // 转换为字符串，返回值+是否成功
+	IsUserdata(idx int) bool           // 检查指定索引值是否为用户数据（全量/轻量）
+	IsLightUserdata(idx int) bool      // 检查指定索引值是否为轻量用户数据
+	ToUserdata(idx int) interface{}    // 获取用户数据保存的Go值（非用户数据返回nil）
+	ToAny(idx int) interface{}         // 将指定索引值转换为对应的Go值（nil/bool/int64/float64/string/用户数据的值）
 
 	/* push functions (Go -> stack) - Go类型值压入栈 */
-	PushNil()             // 压入nil值到栈顶
-	PushBoolean(b bool)   // 压入布尔值到栈顶
-	PushInteger(n int64)  // 压入整数值到栈顶
-	PushNumber(n float64) // 压入浮点数值到栈顶
-	PushString(s string)  // 压入字符串值到栈顶
+	PushNil()              // 压入nil值到栈顶
+	PushBoolean(b bool)    // 压入布尔值到栈顶
+	PushInteger(n int64)   // 压入整数值到栈顶
+	PushNumber(n float64)  // 压入浮点数值到栈顶
+	PushString(s string)   // 压入字符串值到栈顶
+	PushAny(v interface{}) // 按Go值的类型压入对应的Lua值（基础类型以外的值包装为全量用户数据）
+
+	/* userdata - 用户数据 */
+	NewUserdata(value interface{})   // 创建保存value的全量用户数据并压入栈顶
+	PushLightUserdata(p interface{}) // 压入轻量用户数据到栈顶
+	SetUserValue(idx int)            // 弹出栈顶值，设置为指定索引处全量用户数据的用户值
+	GetUserValue(idx int) LuaType    // 将指定索引处全量用户数据的用户值压入栈顶，返回其类型
+
+	/* resource limits - 资源配额 */
+	SetStackLimit(limit int)  // 设置栈的最大容量（元素个数），≤0恢复默认值
+	SetMemoryLimit(limit int) // 设置内存配额（字节），超出时抛出ErrMemoryLimit，≤0表示不限制
+	MemoryUsed() int          // 返回目前累计记入配额的字节数
 
 	Arith(op ArithOp)                          //用于执行算术和按位运算
 	Compare(idx1, odx2 int, op CompareOp) bool //用于执行比较运算
@@ -1,6 +1,8 @@
 // LuaLight/binchunk/binary_chunk.go
 package binchunk
 
+import "strings"
+
 //lua字节码的二进制结构
 
 //header的一些常量
@@ -67,6 +69,15 @@ type Prototype struct {
 	UpvalueNames    []string      // Upvalue的名字
 }
 
+// SourceName 返回去掉了前缀的源文件名，用于报告和调试输出
+// "@foo.lua" → "foo.lua"，"=stdin" → "stdin"，其余原样返回
+func (self *Prototype) SourceName() string {
+	if strings.HasPrefix(self.Source, "@") || strings.HasPrefix(self.Source, "=") {
+		return self.Source[1:]
+	}
+	return self.Source
+}
+
 //Upvalue环境表
 type Upvalue struct {
 	Instack byte // 是否在栈中：1=是，0=否
@@ -0,0 +1,120 @@
+// LuaLight/coverage/cobertura.go
+package coverage
+
+// Cobertura XML格式的输出（Jenkins、GitLab等CI系统可直接识别）
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+)
+
+// Cobertura报告的XML结构（只包含常用的元素和属性）
+type coberturaReport struct {
+	XMLName         xml.Name           `xml:"coverage"`
+	LineRate        string             `xml:"line-rate,attr"`
+	BranchRate      string             `xml:"branch-rate,attr"`
+	LinesCovered    int                `xml:"lines-covered,attr"`
+	LinesValid      int                `xml:"lines-valid,attr"`
+	BranchesCovered int                `xml:"branches-covered,attr"`
+	BranchesValid   int                `xml:"branches-valid,attr"`
+	Complexity      int                `xml:"complexity,attr"`
+	Version         string             `xml:"version,attr"`
+	Timestamp       int64              `xml:"timestamp,attr"`
+	Sources         []string           `xml:"sources>source"`
+	Packages        []coberturaPackage `xml:"packages>package"`
+}
+
+type coberturaPackage struct {
+	Name       string           `xml:"name,attr"`
+	LineRate   string           `xml:"line-rate,attr"`
+	BranchRate string           `xml:"branch-rate,attr"`
+	Complexity int              `xml:"complexity,attr"`
+	Classes    []coberturaClass `xml:"classes>class"`
+}
+
+type coberturaClass struct {
+	Name       string          `xml:"name,attr"`
+	Filename   string          `xml:"filename,attr"`
+	LineRate   string          `xml:"line-rate,attr"`
+	BranchRate string          `xml:"branch-rate,attr"`
+	Complexity int             `xml:"complexity,attr"`
+	Methods    []struct{}      `xml:"methods>method"`
+	Lines      []coberturaLine `xml:"lines>line"`
+}
+
+type coberturaLine struct {
+	Number            int    `xml:"number,attr"`
+	Hits              int    `xml:"hits,attr"`
+	Branch            bool   `xml:"branch,attr"`
+	ConditionCoverage string `xml:"condition-coverage,attr,omitempty"`
+}
+
+// WriteCobertura 以Cobertura XML格式输出覆盖率数据
+// 所有源文件放在同一个package中，每个源文件对应一个class
+func (self *Coverage) WriteCobertura(w io.Writer) error {
+	report := coberturaReport{
+		Version:   "LuaLight",
+		Timestamp: time.Now().UnixMilli(),
+		Sources:   []string{"."},
+	}
+	pkg := coberturaPackage{Name: "lua"}
+	for _, name := range self.fileNames() {
+		file := self.files[name]
+		class := coberturaClass{
+			Name:     strings.TrimSuffix(path.Base(name), path.Ext(name)),
+			Filename: name,
+		}
+
+		brTotal, brCovered := file.branchesByLine()
+		linesCovered, branchesValid, branchesCovered := 0, 0, 0
+		for _, n := range file.sortedLines() {
+			line := coberturaLine{Number: n, Hits: file.lines[n]}
+			if line.Hits > 0 {
+				linesCovered++
+			}
+			if total := brTotal[n]; total > 0 {
+				covered := brCovered[n]
+				line.Branch = true
+				line.ConditionCoverage = fmt.Sprintf("%d%% (%d/%d)", covered*100/total, covered, total)
+				branchesValid += total
+				branchesCovered += covered
+			}
+			class.Lines = append(class.Lines, line)
+		}
+		class.LineRate = rate(linesCovered, len(file.lines))
+		class.BranchRate = rate(branchesCovered, branchesValid)
+		pkg.Classes = append(pkg.Classes, class)
+
+		report.LinesCovered += linesCovered
+		report.LinesValid += len(file.lines)
+		report.BranchesCovered += branchesCovered
+		report.BranchesValid += branchesValid
+	}
+	pkg.LineRate = rate(report.LinesCovered, report.LinesValid)
+	pkg.BranchRate = rate(report.BranchesCovered, report.BranchesValid)
+	report.LineRate, report.BranchRate = pkg.LineRate, pkg.BranchRate
+	report.Packages = []coberturaPackage{pkg}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// rate 计算覆盖率（0~1之间的小数），没有可统计项时视为全部覆盖
+func rate(covered, total int) string {
+	if total == 0 {
+		return "1"
+	}
+	return fmt.Sprintf("%.4f", float64(covered)/float64(total))
+}
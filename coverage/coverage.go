@@ -0,0 +1,250 @@
+// LuaLight/coverage/coverage.go
+package coverage
+
+// 脚本覆盖率统计：行覆盖率、函数覆盖率、分支覆盖率
+// 可执行行、函数、分支点都从函数原型（binchunk.Prototype）静态计算，
+// 因此从未执行过的函数也会以0%出现在报告中；执行信息由虚拟机通过Call/Hit/Branch上报
+// 注意：目前还没有执行字节码的解释器，也就没有地方调用Call/Hit/Branch，
+// 在接入解释器循环之前，命中次数只能来自宿主手动上报或ReadLCOV/Merge合并的外部数据
+
+import (
+	"LuaLight/binchunk"
+	"LuaLight/vm"
+	"fmt"
+	"sort"
+)
+
+// Coverage 覆盖率数据，按源文件分组；可跨多次运行、多个虚拟机合并（见Merge/ReadLCOV）
+type Coverage struct {
+	files     map[string]*fileData               // 源文件名 → 该文件的覆盖率数据
+	protos    map[*binchunk.Prototype]*protoData // 已登记过的函数原型
+	funcNames map[string]bool                    // 已分配给函数原型的函数名
+	nextBlock map[string]int                     // 源文件名 → 下一个登记的函数原型的块号起点
+}
+
+// protoData 登记函数原型时分配的标识
+// 同一文件中的函数可能有相同的行号范围（如f(function() end, function() end)），
+// 指令序号在不同函数之间也会重复，因此函数名和分支块号都按登记顺序分配，保证在文件内唯一
+type protoData struct {
+	name string // 函数名（见funcName）
+	base int    // 块号起点：pc处的条件测试指令的块号为base+pc
+}
+
+// fileData 单个源文件的覆盖率数据
+type fileData struct {
+	lines    map[int]int        // 可执行行号 → 命中次数
+	funcs    map[string]*fnData // 函数名 → 函数信息
+	branches map[branchKey]int  // 分支 → 命中次数
+}
+
+// fnData 单个函数的覆盖率数据
+type fnData struct {
+	line  int // 函数定义起始行号
+	calls int // 调用次数
+}
+
+// branchKey 标识一个分支：条件测试指令所在行号、块号（见protoData.base，作为LCOV的块号）、分支序号
+// 每条条件测试指令有两个分支：0=执行下一条指令（通常是JMP），1=跳过下一条指令
+type branchKey struct {
+	line   int
+	block  int
+	branch int
+}
+
+// New 创建空的覆盖率数据
+func New() *Coverage {
+	return &Coverage{
+		files:     map[string]*fileData{},
+		protos:    map[*binchunk.Prototype]*protoData{},
+		funcNames: map[string]bool{},
+		nextBlock: map[string]int{},
+	}
+}
+
+// AddProto 登记函数原型及其所有子函数的可执行行、函数和分支点（命中次数均为0）
+// 依赖调试信息（LineInfo），被strip过的chunk没有行号信息，无法统计
+// 函数名和块号按登记顺序分配，要让多次运行的结果能够合并，应在执行前先登记主函数
+func (self *Coverage) AddProto(proto *binchunk.Prototype) {
+	if _, ok := self.protos[proto]; ok {
+		return
+	}
+	source := proto.SourceName()
+	data := &protoData{name: self.funcName(proto), base: self.nextBlock[source]}
+	self.protos[proto] = data
+	self.nextBlock[source] += len(proto.Code)
+
+	file := self.file(source)
+	if _, ok := file.funcs[data.name]; !ok {
+		file.funcs[data.name] = &fnData{line: funcLine(proto)}
+	}
+	for pc, line := range proto.LineInfo {
+		if _, ok := file.lines[int(line)]; !ok {
+			file.lines[int(line)] = 0
+		}
+		if vm.Instruction(proto.Code[pc]).TestFlag() {
+			for branch := 0; branch < 2; branch++ {
+				key := branchKey{int(line), data.base + pc, branch}
+				if _, ok := file.branches[key]; !ok {
+					file.branches[key] = 0
+				}
+			}
+		}
+	}
+	for _, p := range proto.Protos {
+		self.AddProto(p)
+	}
+}
+
+// Call 记录一次函数调用（虚拟机每次进入proto时调用）
+func (self *Coverage) Call(proto *binchunk.Prototype) {
+	self.AddProto(proto)
+	self.file(proto.SourceName()).funcs[self.protos[proto].name].calls++
+}
+
+// Hit 记录执行到pc所在的行（虚拟机每执行到新的一行时调用一次，与行钩子的触发时机一致）
+func (self *Coverage) Hit(proto *binchunk.Prototype, pc int) {
+	if pc < len(proto.LineInfo) {
+		self.AddProto(proto)
+		self.file(proto.SourceName()).lines[int(proto.LineInfo[pc])]++
+	}
+}
+
+// Branch 记录条件测试指令（EQ/LT/LE/TEST/TESTSET）的一次执行结果
+// skip：是否跳过了下一条指令
+func (self *Coverage) Branch(proto *binchunk.Prototype, pc int, skip bool) {
+	if pc < len(proto.LineInfo) {
+		self.AddProto(proto)
+		branch := 0
+		if skip {
+			branch = 1
+		}
+		key := branchKey{int(proto.LineInfo[pc]), self.protos[proto].base + pc, branch}
+		self.file(proto.SourceName()).branches[key]++
+	}
+}
+
+// Merge 把other中的数据累加到当前覆盖率数据中
+func (self *Coverage) Merge(other *Coverage) {
+	for name, src := range other.files {
+		dst := self.file(name)
+		for line, n := range src.lines {
+			dst.lines[line] += n
+		}
+		for fn, f := range src.funcs {
+			if d, ok := dst.funcs[fn]; ok {
+				d.calls += f.calls
+			} else {
+				dst.funcs[fn] = &fnData{line: f.line, calls: f.calls}
+			}
+		}
+		for key, n := range src.branches {
+			dst.branches[key] += n
+		}
+	}
+}
+
+// file 获取源文件（报告中使用的文件名，见binchunk.Prototype.SourceName）对应的数据，不存在时创建
+func (self *Coverage) file(name string) *fileData {
+	file, ok := self.files[name]
+	if !ok {
+		file = &fileData{
+			lines:    map[int]int{},
+			funcs:    map[string]*fnData{},
+			branches: map[branchKey]int{},
+		}
+		self.files[name] = file
+	}
+	return file
+}
+
+// funcName 为新登记的函数原型分配报告中的名称，格式与luac -l一致，如“function <foo.lua:1,3>”
+// 与之前登记的函数重名时依次加上“#2”、“#3”……
+func (self *Coverage) funcName(proto *binchunk.Prototype) string {
+	funcType := "main"
+	if proto.LineDefined > 0 {
+		funcType = "function"
+	}
+	name := fmt.Sprintf("%s <%s:%d,%d>", funcType, proto.SourceName(),
+		proto.LineDefined, proto.LastLineDefined)
+	unique := name
+	for n := 2; self.funcNames[unique]; n++ {
+		unique = fmt.Sprintf("%s#%d", name, n)
+	}
+	self.funcNames[unique] = true
+	return unique
+}
+
+// funcLine 函数的起始行号（主函数的LineDefined为0，报告中记为第1行）
+func funcLine(proto *binchunk.Prototype) int {
+	if proto.LineDefined == 0 {
+		return 1
+	}
+	return int(proto.LineDefined)
+}
+
+// fileNames 按字典序返回所有源文件名（保证报告输出稳定）
+func (self *Coverage) fileNames() []string {
+	names := make([]string, 0, len(self.files))
+	for name := range self.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// sortedLines 按行号排序返回所有可执行行
+func (self *fileData) sortedLines() []int {
+	lines := make([]int, 0, len(self.lines))
+	for line := range self.lines {
+		lines = append(lines, line)
+	}
+	sort.Ints(lines)
+	return lines
+}
+
+// sortedFuncs 按起始行号（相同时按名称）排序返回所有函数名
+func (self *fileData) sortedFuncs() []string {
+	names := make([]string, 0, len(self.funcs))
+	for name := range self.funcs {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		a, b := self.funcs[names[i]], self.funcs[names[j]]
+		if a.line != b.line {
+			return a.line < b.line
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
+
+// sortedBranches 按行号、块号、分支序号排序返回所有分支
+func (self *fileData) sortedBranches() []branchKey {
+	keys := make([]branchKey, 0, len(self.branches))
+	for key := range self.branches {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.line != b.line {
+			return a.line < b.line
+		}
+		if a.block != b.block {
+			return a.block < b.block
+		}
+		return a.branch < b.branch
+	})
+	return keys
+}
+
+// branchesByLine 统计每一行的分支总数和被命中的分支数
+func (self *fileData) branchesByLine() (total, covered map[int]int) {
+	total, covered = map[int]int{}, map[int]int{}
+	for key, n := range self.branches {
+		total[key.line]++
+		if n > 0 {
+			covered[key.line]++
+		}
+	}
+	return
+}
@@ -0,0 +1,278 @@
+package coverage
+
+import (
+	"LuaLight/binchunk"
+	. "LuaLight/vm"
+	"bytes"
+	"encoding/xml"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testProto 手工构造的chunk：
+//
+//	main（第1～4行）：第2行一条EQ（两个分支），第4行RETURN；
+//	function <t.lua:2,3>：第3行RETURN
+func testProto() *binchunk.Prototype {
+	sub := &binchunk.Prototype{
+		Source:          "@t.lua",
+		LineDefined:     2,
+		LastLineDefined: 3,
+		Code:            []uint32{uint32(CreateABC(OP_RETURN, 0, 1, 0))},
+		LineInfo:        []uint32{3},
+	}
+	return &binchunk.Prototype{
+		Source: "@t.lua",
+		Code: []uint32{
+			uint32(CreateABx(OP_CLOSURE, 0, 0)),
+			uint32(CreateABC(OP_EQ, 0, 0, 0x100)),
+			uint32(CreateAsBx(OP_JMP, 0, 0)),
+			uint32(CreateABC(OP_RETURN, 0, 1, 0)),
+		},
+		LineInfo: []uint32{1, 2, 2, 4},
+		Protos:   []*binchunk.Prototype{sub},
+	}
+}
+
+func TestAddProto(t *testing.T) {
+	c := New()
+	proto := testProto()
+	c.AddProto(proto)
+	c.AddProto(proto) // 重复登记不影响结果
+
+	if len(c.files) != 1 {
+		t.Fatalf("files = %v, want only t.lua", c.fileNames())
+	}
+	file := c.files["t.lua"]
+	if want := map[int]int{1: 0, 2: 0, 3: 0, 4: 0}; !reflect.DeepEqual(file.lines, want) {
+		t.Errorf("lines = %v, want %v", file.lines, want)
+	}
+	wantFuncs := map[string]fnData{
+		"main <t.lua:0,0>":     {line: 1},
+		"function <t.lua:2,3>": {line: 2},
+	}
+	if len(file.funcs) != len(wantFuncs) {
+		t.Errorf("funcs = %v, want %v", file.sortedFuncs(), wantFuncs)
+	}
+	for name, want := range wantFuncs {
+		if got, ok := file.funcs[name]; !ok || *got != want {
+			t.Errorf("funcs[%q] = %v, want %v", name, got, want)
+		}
+	}
+	wantBranches := map[branchKey]int{{2, 1, 0}: 0, {2, 1, 1}: 0}
+	if !reflect.DeepEqual(file.branches, wantBranches) {
+		t.Errorf("branches = %v, want %v", file.branches, wantBranches)
+	}
+}
+
+func TestHits(t *testing.T) {
+	c := New()
+	proto := testProto()
+	c.Call(proto)
+	c.Hit(proto, 0)
+	c.Hit(proto, 1)
+	c.Branch(proto, 1, true)
+	c.Hit(proto, 3)
+
+	file := c.files["t.lua"]
+	if want := map[int]int{1: 1, 2: 1, 3: 0, 4: 1}; !reflect.DeepEqual(file.lines, want) {
+		t.Errorf("lines = %v, want %v", file.lines, want)
+	}
+	if calls := file.funcs["main <t.lua:0,0>"].calls; calls != 1 {
+		t.Errorf("main calls = %d, want 1", calls)
+	}
+	if calls := file.funcs["function <t.lua:2,3>"].calls; calls != 0 {
+		t.Errorf("function calls = %d, want 0", calls)
+	}
+	if want := map[branchKey]int{{2, 1, 0}: 0, {2, 1, 1}: 1}; !reflect.DeepEqual(file.branches, want) {
+		t.Errorf("branches = %v, want %v", file.branches, want)
+	}
+}
+
+// executed 返回执行过一次main（走了跳过JMP的分支）的覆盖率数据
+func executed() *Coverage {
+	c := New()
+	proto := testProto()
+	c.Call(proto)
+	c.Hit(proto, 0)
+	c.Hit(proto, 1)
+	c.Branch(proto, 1, true)
+	c.Hit(proto, 3)
+	return c
+}
+
+func TestLCOVRoundTrip(t *testing.T) {
+	c := executed()
+	var buf bytes.Buffer
+	if err := c.WriteLCOV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want := `TN:
+SF:t.lua
+FN:1,main <t.lua:0,0>
+FN:2,function <t.lua:2,3>
+FNDA:1,main <t.lua:0,0>
+FNDA:0,function <t.lua:2,3>
+FNF:2
+FNH:1
+BRDA:2,1,0,0
+BRDA:2,1,1,1
+BRF:2
+BRH:1
+DA:1,1
+DA:2,1
+DA:3,0
+DA:4,1
+LF:4
+LH:3
+end_of_record
+`
+	if buf.String() != want {
+		t.Fatalf("WriteLCOV:\n%s\nwant:\n%s", buf.String(), want)
+	}
+
+	read := New()
+	if err := read.ReadLCOV(strings.NewReader(want)); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(read.files, c.files) {
+		t.Errorf("ReadLCOV(WriteLCOV(c)) differs from c")
+	}
+}
+
+func TestReadLCOVError(t *testing.T) {
+	err := New().ReadLCOV(strings.NewReader("SF:t.lua\nDA:x,1\n"))
+	if err == nil || !strings.HasPrefix(err.Error(), "lcov:2:") {
+		t.Errorf("err = %v, want error at line 2", err)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	c := executed()
+	c.Merge(executed())
+
+	file := c.files["t.lua"]
+	if want := map[int]int{1: 2, 2: 2, 3: 0, 4: 2}; !reflect.DeepEqual(file.lines, want) {
+		t.Errorf("lines = %v, want %v", file.lines, want)
+	}
+	if calls := file.funcs["main <t.lua:0,0>"].calls; calls != 2 {
+		t.Errorf("main calls = %d, want 2", calls)
+	}
+	if want := map[branchKey]int{{2, 1, 0}: 0, {2, 1, 1}: 2}; !reflect.DeepEqual(file.branches, want) {
+		t.Errorf("branches = %v, want %v", file.branches, want)
+	}
+
+	// 通过LCOV文件合并，结果相同
+	var buf bytes.Buffer
+	executed().WriteLCOV(&buf)
+	viaLCOV := executed()
+	if err := viaLCOV.ReadLCOV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(viaLCOV.files, c.files) {
+		t.Errorf("ReadLCOV merge differs from Merge")
+	}
+}
+
+func TestWriteCobertura(t *testing.T) {
+	var buf bytes.Buffer
+	if err := executed().WriteCobertura(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var report coberturaReport
+	if err := xml.Unmarshal(buf.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.LinesValid != 4 || report.LinesCovered != 3 || report.LineRate != "0.7500" {
+		t.Errorf("lines: valid=%d covered=%d rate=%s, want 4/3/0.7500",
+			report.LinesValid, report.LinesCovered, report.LineRate)
+	}
+	if report.BranchesValid != 2 || report.BranchesCovered != 1 || report.BranchRate != "0.5000" {
+		t.Errorf("branches: valid=%d covered=%d rate=%s, want 2/1/0.5000",
+			report.BranchesValid, report.BranchesCovered, report.BranchRate)
+	}
+	if len(report.Packages) != 1 || len(report.Packages[0].Classes) != 1 {
+		t.Fatalf("want one package with one class, got %+v", report.Packages)
+	}
+	class := report.Packages[0].Classes[0]
+	if class.Name != "t" || class.Filename != "t.lua" || len(class.Lines) != 4 {
+		t.Errorf("class = %+v", class)
+	}
+	if line := class.Lines[1]; !line.Branch || line.ConditionCoverage != "50% (1/2)" {
+		t.Errorf("line 2 = %+v, want branch with 50%% (1/2)", line)
+	}
+}
+
+// 同一行上的多个函数（如f(function() end, function() end)）各自有独立的函数记录和分支块
+func TestSameLineFunctions(t *testing.T) {
+	sub := func() *binchunk.Prototype {
+		return &binchunk.Prototype{
+			Source:          "@t.lua",
+			LineDefined:     1,
+			LastLineDefined: 1,
+			Code: []uint32{
+				uint32(CreateABC(OP_TEST, 0, 0, 0)),
+				uint32(CreateAsBx(OP_JMP, 0, 0)),
+				uint32(CreateABC(OP_RETURN, 0, 1, 0)),
+			},
+			LineInfo: []uint32{1, 1, 1},
+		}
+	}
+	proto := &binchunk.Prototype{
+		Source: "@t.lua",
+		Code: []uint32{
+			uint32(CreateABC(OP_TEST, 0, 0, 0)),
+			uint32(CreateAsBx(OP_JMP, 0, 0)),
+			uint32(CreateABx(OP_CLOSURE, 0, 0)),
+			uint32(CreateABx(OP_CLOSURE, 1, 1)),
+			uint32(CreateABC(OP_RETURN, 0, 1, 0)),
+		},
+		LineInfo: []uint32{1, 1, 1, 1, 1},
+		Protos:   []*binchunk.Prototype{sub(), sub()},
+	}
+	c := New()
+	c.AddProto(proto)
+	c.Call(proto.Protos[0])
+	c.Hit(proto.Protos[0], 0)
+	c.Branch(proto.Protos[0], 0, true)
+
+	var buf bytes.Buffer
+	if err := c.WriteLCOV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want := `TN:
+SF:t.lua
+FN:1,function <t.lua:1,1>
+FN:1,function <t.lua:1,1>#2
+FN:1,main <t.lua:0,0>
+FNDA:1,function <t.lua:1,1>
+FNDA:0,function <t.lua:1,1>#2
+FNDA:0,main <t.lua:0,0>
+FNF:3
+FNH:1
+BRDA:1,0,0,0
+BRDA:1,0,1,0
+BRDA:1,5,0,0
+BRDA:1,5,1,1
+BRDA:1,8,0,0
+BRDA:1,8,1,0
+BRF:6
+BRH:1
+DA:1,1
+LF:1
+LH:1
+end_of_record
+`
+	if buf.String() != want {
+		t.Fatalf("WriteLCOV:\n%s\nwant:\n%s", buf.String(), want)
+	}
+
+	read := New()
+	if err := read.ReadLCOV(strings.NewReader(want)); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(read.files, c.files) {
+		t.Errorf("ReadLCOV(WriteLCOV(c)) differs from c")
+	}
+}
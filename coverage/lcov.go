@@ -0,0 +1,178 @@
+// LuaLight/coverage/lcov.go
+package coverage
+
+// LCOV格式（.info）的读写，格式说明见geninfo(1)
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// WriteLCOV 以LCOV tracefile格式输出覆盖率数据
+func (self *Coverage) WriteLCOV(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, name := range self.fileNames() {
+		file := self.files[name]
+		fmt.Fprintf(bw, "TN:\nSF:%s\n", name)
+
+		// 函数：FN/FNDA/FNF/FNH
+		funcs := file.sortedFuncs()
+		fnHit := 0
+		for _, fn := range funcs {
+			fmt.Fprintf(bw, "FN:%d,%s\n", file.funcs[fn].line, fn)
+		}
+		for _, fn := range funcs {
+			calls := file.funcs[fn].calls
+			if calls > 0 {
+				fnHit++
+			}
+			fmt.Fprintf(bw, "FNDA:%d,%s\n", calls, fn)
+		}
+		fmt.Fprintf(bw, "FNF:%d\nFNH:%d\n", len(funcs), fnHit)
+
+		// 分支：BRDA/BRF/BRH，所在行未执行过时命中次数记为“-”
+		branches := file.sortedBranches()
+		brHit := 0
+		for _, key := range branches {
+			taken := "-"
+			if file.lines[key.line] > 0 {
+				taken = strconv.Itoa(file.branches[key])
+			}
+			if file.branches[key] > 0 {
+				brHit++
+			}
+			fmt.Fprintf(bw, "BRDA:%d,%d,%d,%s\n", key.line, key.block, key.branch, taken)
+		}
+		fmt.Fprintf(bw, "BRF:%d\nBRH:%d\n", len(branches), brHit)
+
+		// 行：DA/LF/LH
+		lines := file.sortedLines()
+		lineHit := 0
+		for _, line := range lines {
+			if file.lines[line] > 0 {
+				lineHit++
+			}
+			fmt.Fprintf(bw, "DA:%d,%d\n", line, file.lines[line])
+		}
+		fmt.Fprintf(bw, "LF:%d\nLH:%d\nend_of_record\n", len(lines), lineHit)
+	}
+	return bw.Flush()
+}
+
+// ReadLCOV 读取LCOV tracefile，并把其中的数据累加到当前覆盖率数据中（用于合并多次运行的结果）
+// 只识别WriteLCOV会输出的记录（SF/FN/FNDA/BRDA/DA/end_of_record），其余记录忽略
+func (self *Coverage) ReadLCOV(r io.Reader) error {
+	var file *fileData
+	scanner := bufio.NewScanner(r)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		record := strings.TrimSpace(scanner.Text())
+		tag, value, _ := strings.Cut(record, ":")
+		if tag == "SF" {
+			file = self.file(value)
+			continue
+		} else if tag == "end_of_record" {
+			file = nil
+			continue
+		}
+
+		if file == nil {
+			continue // SF之外的记录，忽略
+		}
+		fields := strings.Split(value, ",")
+		var err error
+		switch tag {
+		case "FN": // FN:<行号>,<函数名>
+			err = file.readFN(fields)
+		case "FNDA": // FNDA:<调用次数>,<函数名>
+			err = file.readFNDA(fields)
+		case "BRDA": // BRDA:<行号>,<块号>,<分支号>,<命中次数或->
+			err = file.readBRDA(fields)
+		case "DA": // DA:<行号>,<命中次数>[,<校验和>]
+			err = file.readDA(fields)
+		}
+		if err != nil {
+			return fmt.Errorf("lcov:%d: %v", lineNo, err)
+		}
+	}
+	return scanner.Err()
+}
+
+// readFN 解析FN记录：登记函数及其起始行号
+func (self *fileData) readFN(fields []string) error {
+	if len(fields) < 2 {
+		return fmt.Errorf("malformed FN record")
+	}
+	line, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return err
+	}
+	name := strings.Join(fields[1:], ",") // 函数名本身含有逗号（如“<foo.lua:1,3>”）
+	if _, ok := self.funcs[name]; !ok {
+		self.funcs[name] = &fnData{line: line}
+	}
+	return nil
+}
+
+// readFNDA 解析FNDA记录：累加函数调用次数
+func (self *fileData) readFNDA(fields []string) error {
+	if len(fields) < 2 {
+		return fmt.Errorf("malformed FNDA record")
+	}
+	calls, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return err
+	}
+	name := strings.Join(fields[1:], ",")
+	if fn, ok := self.funcs[name]; ok {
+		fn.calls += calls
+	} else {
+		self.funcs[name] = &fnData{calls: calls}
+	}
+	return nil
+}
+
+// readBRDA 解析BRDA记录：累加分支命中次数（“-”表示所在行未执行，记为0）
+func (self *fileData) readBRDA(fields []string) error {
+	if len(fields) != 4 {
+		return fmt.Errorf("malformed BRDA record")
+	}
+	var key branchKey
+	var err error
+	if key.line, err = strconv.Atoi(fields[0]); err != nil {
+		return err
+	}
+	if key.block, err = strconv.Atoi(fields[1]); err != nil {
+		return err
+	}
+	if key.branch, err = strconv.Atoi(fields[2]); err != nil {
+		return err
+	}
+	taken := 0
+	if fields[3] != "-" {
+		if taken, err = strconv.Atoi(fields[3]); err != nil {
+			return err
+		}
+	}
+	self.branches[key] += taken
+	return nil
+}
+
+// readDA 解析DA记录：累加行命中次数
+func (self *fileData) readDA(fields []string) error {
+	if len(fields) < 2 {
+		return fmt.Errorf("malformed DA record")
+	}
+	line, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return err
+	}
+	hits, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return err
+	}
+	self.lines[line] += hits
+	return nil
+}
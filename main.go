@@ -6,19 +6,28 @@ import (
 	"LuaLight/binchunk"
 	"LuaLight/state"
 	. "LuaLight/vm"
+	"LuaLight/vm/opt"
+	"flag"
 	"fmt"
+	"os"
 )
 
 func main() {
-	//2-3章用
-	// if len(os.Args) > 1 {
-	// 	data, err := os.ReadFile(os.Args[1])
-	// 	if err != nil {
-	// 		panic(err)
-	// 	}
-	// 	proto := binchunk.Undump(data)
-	// 	list(proto)
-	// }
+	//2-3章用：反汇编chunk（类似luac -l），-O表示先经过优化器（vm/opt）再输出
+	optimize := flag.Bool("O", false, "optimize bytecode before listing")
+	flag.Parse()
+	if flag.NArg() > 0 {
+		data, err := os.ReadFile(flag.Arg(0))
+		if err != nil {
+			panic(err)
+		}
+		proto := binchunk.Undump(data)
+		if *optimize {
+			opt.Optimize(proto)
+		}
+		list(proto)
+		return
+	}
 	//---4章
 	// ls := state.New()
 	// ls.PushBoolean(true)
@@ -98,8 +107,7 @@ func printCode(f *binchunk.Prototype) {
 		i := Instruction(c)
 		fmt.Printf("\t%d\t[%s]\t%s \t", pc+1, line, i.OpName())
 		//fmt.Printf("\t%d\t[%s]\t0x%08x\n", pc+1, line, c)
-		printOperands(i)
-		fmt.Printf("\n")
+		fmt.Println(i.Operands())
 	}
 }
 
@@ -149,44 +157,6 @@ func upvalName(f *binchunk.Prototype, idx int) string {
 	return "-"
 }
 
-// 打印操作码
-func printOperands(i Instruction) {
-	switch i.OpMode() {
-	case IABC:
-		a, b, c := i.ABC()
-		fmt.Printf("%d", a)
-		if i.BMode() != OpArgN {
-			if b > 0xFF {
-				fmt.Printf(" %d", -1-b&0xFF)
-			} else {
-				fmt.Printf(" %d", b)
-			}
-		}
-
-		if i.CMode() != OpArgN {
-			if c > 0xFF {
-				fmt.Printf(" %d", -1-c&0xFF)
-			} else {
-				fmt.Printf(" %d", c)
-			}
-		}
-	case IABx:
-		a, bx := i.ABx()
-		fmt.Printf("%d", a)
-		if i.BMode() == OpArgK {
-			fmt.Printf(" %d", -1-bx)
-		} else if i.BMode() == OpArgU {
-			fmt.Printf(" %d", bx)
-		}
-	case IAsBx:
-		a, sbx := i.AsBx()
-		fmt.Printf("%d %d", a, sbx)
-	case IAx:
-		ax := i.Ax()
-		fmt.Printf("%d", -1-ax)
-	}
-}
-
 // 打印栈
 func printStack(ls LuaState) {
 	top := ls.GetTop()
@@ -0,0 +1,28 @@
+package number
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// 浮点数转化为字符串（与官方lua_Number2str一致，格式为"%.14g"）
+// 结果看起来像整数时补上".0"（如1.0），以便与整数区分
+func FloatToString(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	case math.IsNaN(f):
+		if math.Signbit(f) {
+			return "-nan"
+		}
+		return "nan"
+	}
+	s := strconv.FormatFloat(f, 'g', 14, 64)
+	if strings.Trim(s, "-0123456789") == "" {
+		s += ".0"
+	}
+	return s
+}
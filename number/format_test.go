@@ -0,0 +1,36 @@
+package number
+
+import (
+	"math"
+	"testing"
+)
+
+// 期望结果与Lua 5.3的tostring一致
+func TestFloatToString(t *testing.T) {
+	tests := []struct {
+		f    float64
+		want string
+	}{
+		{0, "0.0"},
+		{math.Copysign(0, -1), "-0.0"},
+		{1, "1.0"},
+		{-4, "-4.0"},
+		{3.14, "3.14"},
+		{0.1, "0.1"},
+		{1e14, "1e+14"},
+		{123456789012345, "1.2345678901234e+14"},
+		{99999999999999, "99999999999999.0"},
+		{1e100, "1e+100"},
+		{-2.5e-7, "-2.5e-07"},
+		{1.0 / 3, "0.33333333333333"},
+		{math.Inf(1), "inf"},
+		{math.Inf(-1), "-inf"},
+		{math.NaN(), "nan"},
+		{math.Copysign(math.NaN(), -1), "-nan"},
+	}
+	for _, test := range tests {
+		if got := FloatToString(test.f); got != test.want {
+			t.Errorf("FloatToString(%v) = %q, want %q", test.f, got, test.want)
+		}
+	}
+}
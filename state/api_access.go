@@ -6,7 +6,6 @@ package state
 
 import (
 	. "LuaLight/api" // 导入Lua类型常量（如LUA_TNIL/LUA_TBOOLEAN等）
-	"fmt"
 )
 
 // TypeName 将Lua类型标识（LuaType）转换为可读的类型名称
@@ -85,8 +84,7 @@ func (self *luaState) IsNumber(idx int) bool {
 // 仅严格匹配int64类型，数值类型的float64（如10.0）会返回false
 func (self *luaState) IsInteger(idx int) bool {
 	val := self.stack.get(idx)
-	_, ok := val.(int64) // 类型断言判断是否为int64
-	return ok
+	return val.tag == tagInteger // 判断类型标签是否为整数
 }
 
 // ToBoolean 将指定索引位置的元素转换为布尔值（Lua布尔转换规则）
@@ -134,12 +132,13 @@ func (self *luaState) ToIntegerX(idx int) (int64, bool) {
 // 3. 其余类型：转换失败
 func (self *luaState) ToStringX(idx int) (string, bool) {
 	val := self.stack.get(idx)
-	switch x := val.(type) {
-	case string:
-		return x, true
-	case int64, float64:
-		s := fmt.Sprintf("%v", x) // 数值转字符串
-		self.stack.set(idx, s)    // 替换栈中原值（Lua的自动类型转换）
+	switch val.tag {
+	case tagString:
+		return val.str(), true
+	case tagInteger, tagFloat:
+		s := numberToString(val)               // 数值转字符串
+		self.alloc(len(s))                     // 转换出的字符串计入内存配额
+		self.stack.set(idx, self.newString(s)) // 替换栈中原值（Lua的自动类型转换）
 		return s, true
 	default:
 		return "", false // 非字符串/数值类型转换失败
@@ -152,3 +151,49 @@ func (self *luaState) ToString(idx int) string {
 	s, _ := self.ToStringX(idx)
 	return s
 }
+
+// IsUserdata 判断指定索引位置的元素是否为用户数据（全量或轻量）
+func (self *luaState) IsUserdata(idx int) bool {
+	t := self.Type(idx)
+	return t == LUA_TUSERDATA || t == LUA_TLIGHTUSERDATA
+}
+
+// IsLightUserdata 判断指定索引位置的元素是否为轻量用户数据
+func (self *luaState) IsLightUserdata(idx int) bool {
+	return self.Type(idx) == LUA_TLIGHTUSERDATA
+}
+
+// ToUserdata 获取指定索引位置用户数据中保存的Go值
+// 全量用户数据返回创建时传入的value，轻量用户数据返回p，其余类型返回nil
+func (self *luaState) ToUserdata(idx int) interface{} {
+	val := self.stack.get(idx)
+	switch val.tag {
+	case tagUserdata:
+		return val.toUserdata().value
+	case tagLightUserdata:
+		return val.p
+	default:
+		return nil
+	}
+}
+
+// ToAny 将指定索引位置的元素转换为对应的Go值（PushAny的逆操作）
+// nil → nil，布尔值 → bool，整数 → int64，浮点数 → float64，字符串 → string，
+// 用户数据 → 其中保存的Go值；无效索引返回nil
+func (self *luaState) ToAny(idx int) interface{} {
+	val := self.stack.get(idx)
+	switch val.tag {
+	case tagBoolean:
+		return val.boolean()
+	case tagInteger:
+		return val.integer()
+	case tagFloat:
+		return val.float()
+	case tagString:
+		return val.str()
+	case tagUserdata, tagLightUserdata:
+		return self.ToUserdata(idx)
+	default:
+		return nil
+	}
+}
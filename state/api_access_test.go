@@ -0,0 +1,41 @@
+package state
+
+import (
+	"math"
+	"testing"
+)
+
+// ToStringX与ToString2按同样的规则把数值转换为字符串（与Lua的tostring一致）
+func TestNumberToString(t *testing.T) {
+	tests := []struct {
+		push func(ls *luaState)
+		want string
+	}{
+		{func(ls *luaState) { ls.PushInteger(4) }, "4"},
+		{func(ls *luaState) { ls.PushInteger(math.MinInt64) }, "-9223372036854775808"},
+		{func(ls *luaState) { ls.PushNumber(4) }, "4.0"},
+		{func(ls *luaState) { ls.PushNumber(0.5) }, "0.5"},
+		{func(ls *luaState) { ls.PushNumber(1e100) }, "1e+100"},
+		{func(ls *luaState) { ls.PushNumber(math.Inf(1)) }, "inf"},
+		{func(ls *luaState) { ls.PushNumber(math.Inf(-1)) }, "-inf"},
+		{func(ls *luaState) { ls.PushNumber(math.NaN()) }, "nan"},
+	}
+	for _, test := range tests {
+		ls := New()
+		test.push(ls)
+		if got := ls.ToString2(1); got != test.want {
+			t.Errorf("ToString2 = %q, want %q", got, test.want)
+		}
+		if !ls.IsNumber(1) {
+			t.Errorf("ToString2 converted the value in place")
+		}
+
+		// ToStringX把栈中的数值原地替换为转换后的字符串
+		if got, ok := ls.ToStringX(1); !ok || got != test.want {
+			t.Errorf("ToStringX = %q, %v, want %q", got, ok, test.want)
+		}
+		if ls.stack.get(1).tag != tagString {
+			t.Errorf("ToStringX left a %s in the slot, want string", ls.TypeName2(1))
+		}
+	}
+}
@@ -91,7 +91,7 @@ func (self *luaState) Arith(op ArithOp) {
 	// 获取当前运算的实现函数
 	operator := operators[op]
 	// 执行运算并处理结果
-	if result := _arith(a, b, operator); result != nil {
+	if result, ok := _arith(a, b, operator); ok {
 		self.stack.push(result) // 运算成功：结果压栈
 	} else {
 		panic("arithmetic error") // 运算失败：类型不支持/转换失败
@@ -99,37 +99,35 @@ func (self *luaState) Arith(op ArithOp) {
 }
 
 // _arith 核心运算执行逻辑（内部辅助函数）
-// a/b：运算操作数；op：运算实现；返回值：运算结果（nil表示失败）
+// a/b：运算操作数；op：运算实现；返回值：运算结果、是否成功
 // 执行优先级：
 // 1. 仅整数运算（按位操作）：尝试将a/b转为整数，执行整数函数；
 // 2. 混合运算（算术操作）：优先用整数运算，失败则转浮点数运算；
 // 3. 仅浮点数运算（幂/普通除法）：尝试将a/b转为浮点数，执行浮点数函数；
-func _arith(a, b luaValue, op operator) luaValue {
+func _arith(a, b luaValue, op operator) (luaValue, bool) {
 	// 分支1：仅支持整数运算（按位操作，floatFunc为nil）
 	if op.floatFunc == nil {
 		// 尝试将a/b转为整数，成功则执行整数运算
 		if x, ok := convertToInteger(a); ok {
 			if y, ok := convertToInteger(b); ok {
-				return op.integerFunc(x, y)
+				return integerValue(op.integerFunc(x, y)), true
 			}
 		}
 		// 分支2：支持浮点数/混合运算（算术操作）
 	} else {
 		// 子分支2.1：优先执行整数运算（提升性能）
 		if op.integerFunc != nil {
-			if x, ok := a.(int64); ok {
-				if y, ok := b.(int64); ok {
-					return op.integerFunc(x, y)
-				}
+			if a.tag == tagInteger && b.tag == tagInteger {
+				return integerValue(op.integerFunc(a.integer(), b.integer())), true
 			}
 		}
 		// 子分支2.2：整数运算失败，尝试转浮点数运算
 		if x, ok := convertToFloat(a); ok {
 			if y, ok := convertToFloat(b); ok {
-				return op.floatFunc(x, y)
+				return floatValue(op.floatFunc(x, y)), true
 			}
 		}
 	}
 	// 所有转换/运算都失败（如操作数是字符串/table）
-	return nil
+	return nilValue, false
 }
@@ -35,35 +35,40 @@ func (self *luaState) Compare(idx1, idx2 int, op CompareOp) bool {
 // 4. 数值类型（int64/float64）跨类型比较（如10==10.0返回true）；
 // 5. 其他类型（table/function等）仅引用相同时相等；
 func _eq(a, b luaValue) bool {
-	switch x := a.(type) {
-	case nil: // a是nil：仅当b也是nil时相等
-		return b == nil
-	case bool: // a是布尔值：b必须也是布尔值且值相同
-		y, ok := b.(bool)
-		return ok && x == y
-	case string: // a是字符串：b必须也是字符串且内容相同
-		y, ok := b.(string)
-		return ok && x == y
-	case int64: // a是整数：支持和int64/float64比较
-		switch y := b.(type) {
-		case int64: // b是整数：直接比较值
+	switch a.tag {
+	case tagNil: // a是nil：仅当b也是nil时相等
+		return b.tag == tagNil
+	case tagBoolean: // a是布尔值：b必须也是布尔值且值相同
+		return b.tag == tagBoolean && a.boolean() == b.boolean()
+	case tagString: // a是字符串：b必须也是字符串且内容相同
+		if b.tag != tagString {
+			return false
+		}
+		x, y := a.p.(*luaString), b.p.(*luaString)
+		if x == y || len(x.s) <= LUAI_MAXSHORTLEN { // 短字符串都经过内部化：比较指针即可
 			return x == y
-		case float64: // b是浮点数：转浮点数后比较（10==10.0→true）
-			return float64(x) == y
+		}
+		return x.s == y.s
+	case tagInteger: // a是整数：支持和整数/浮点数比较
+		switch b.tag {
+		case tagInteger: // b是整数：直接比较值
+			return a.integer() == b.integer()
+		case tagFloat: // b是浮点数：转浮点数后比较（10==10.0→true）
+			return float64(a.integer()) == b.float()
 		default: // b是其他类型：不相等
 			return false
 		}
-	case float64: // a是浮点数：支持和float64/int64比较
-		switch y := b.(type) {
-		case float64: // b是浮点数：直接比较值
-			return x == y
-		case int64: // b是整数：转浮点数后比较（10.0==10→true）
-			return x == float64(y)
+	case tagFloat: // a是浮点数：支持和浮点数/整数比较
+		switch b.tag {
+		case tagFloat: // b是浮点数：直接比较值
+			return a.float() == b.float()
+		case tagInteger: // b是整数：转浮点数后比较（10.0==10→true）
+			return a.float() == float64(b.integer())
 		default: // b是其他类型：不相等
 			return false
 		}
-	default: // 其他类型（table/function/thread等）：仅引用相同才相等
-		return a == b
+	default: // 其他类型（用户数据等）：仅引用相同才相等
+		return a.tag == b.tag && a.p == b.p
 	}
 }
 
@@ -72,46 +77,46 @@ func _eq(a, b luaValue) bool {
 // 1. 仅支持字符串和字符串比较（按字典序）、数值和数值比较（跨int/float）；
 // 2. 其他类型（bool/table等）比较会触发panic；
 func _lt(a, b luaValue) bool {
-	switch x := a.(type) {
-	case string: // a是字符串：b必须也是字符串，按字典序比较
-		if y, ok := b.(string); ok {
-			return x < y
+	switch a.tag {
+	case tagString: // a是字符串：b必须也是字符串，按字典序比较
+		if b.tag == tagString {
+			return a.str() < b.str()
 		}
-	case int64: // a是整数：支持和int64/float64比较
-		switch y := b.(type) {
-		case int64: // b是整数：直接比较
-			return x < y
-		case float64: // b是浮点数：转浮点数后比较
-			return float64(x) < y
+	case tagInteger: // a是整数：支持和整数/浮点数比较
+		switch b.tag {
+		case tagInteger: // b是整数：直接比较
+			return a.integer() < b.integer()
+		case tagFloat: // b是浮点数：转浮点数后比较
+			return float64(a.integer()) < b.float()
 		}
-		// 注意：_lt未处理float64类型的a！因为float64的a会走default触发panic
-		// （这是代码的简化设计，完整实现需补充float64分支，和_le对齐）
+		// 注意：_lt未处理浮点数类型的a！因为浮点数的a会走default触发panic
+		// （这是代码的简化设计，完整实现需补充tagFloat分支，和_le对齐）
 	}
 	// 不支持的比较类型（如bool/table/浮点数a等）
 	panic("comparison error")
 }
 
-// _le 实现Lua的“小于等于（<=）”比较规则（核心：比_lt多支持float64类型的a）
-// 规则和_lt一致，仅补充了float64类型的处理，支持更完整的数值比较
+// _le 实现Lua的“小于等于（<=）”比较规则（核心：比_lt多支持浮点数类型的a）
+// 规则和_lt一致，仅补充了浮点数类型的处理，支持更完整的数值比较
 func _le(a, b luaValue) bool {
-	switch x := a.(type) {
-	case string: // a是字符串：b必须也是字符串，按字典序比较
-		if y, ok := b.(string); ok {
-			return x <= y
+	switch a.tag {
+	case tagString: // a是字符串：b必须也是字符串，按字典序比较
+		if b.tag == tagString {
+			return a.str() <= b.str()
 		}
-	case int64: // a是整数：支持和int64/float64比较
-		switch y := b.(type) {
-		case int64:
-			return x <= y
-		case float64:
-			return float64(x) <= y
+	case tagInteger: // a是整数：支持和整数/浮点数比较
+		switch b.tag {
+		case tagInteger:
+			return a.integer() <= b.integer()
+		case tagFloat:
+			return float64(a.integer()) <= b.float()
 		}
-	case float64: // a是浮点数：支持和float64/int64比较（_lt未处理此分支）
-		switch y := b.(type) {
-		case float64:
-			return x <= y
-		case int64:
-			return x <= float64(y)
+	case tagFloat: // a是浮点数：支持和浮点数/整数比较（_lt未处理此分支）
+		switch b.tag {
+		case tagFloat:
+			return a.float() <= b.float()
+		case tagInteger:
+			return a.float() <= float64(b.integer())
 		}
 	}
 	// 不支持的比较类型
@@ -1,30 +1,41 @@
 package state
 
+import "strings"
+
 //访问指定索引处的值，取其长度，然后推入栈顶
 func (self *luaState) Len(idx int) {
 	val := self.stack.get(idx)
-	if s, ok := val.(string); ok {
-		self.stack.push(int64(len(s)))
+	if val.tag == tagString {
+		self.stack.push(integerValue(int64(len(val.str()))))
 	} else {
 		panic("length error!")
 	}
 }
 
 //从栈顶弹出n个值，对这些值进行拼接，然后把结果推入栈顶
+//先检查所有操作数并算出结果的总长度，类型错误或超出内存配额时栈保持原样
 func (self *luaState) Concat(n int) {
 	if n == 0 {
-		self.stack.push("")
+		self.stack.push(self.newString(""))
 	} else if n >= 2 {
-		for i := 1; i < n; i++ {
-			if self.IsString(-1) && self.IsString(-2) {
-				s2 := self.ToString(-1)
-				s1 := self.ToString(-2)
-				self.stack.pop()
-				self.stack.pop()
-				self.stack.push(s1 + s2)
-				continue
+		parts := make([]string, n)
+		total := 0
+		for i := range parts {
+			val := self.stack.get(i - n)
+			switch val.tag {
+			case tagString:
+				parts[i] = val.str()
+			case tagInteger, tagFloat:
+				parts[i] = numberToString(val) // 数值按Lua的规则转换为字符串
+			default:
+				panic("concatenation error!")
 			}
-			panic("concatenation error!")
+			total += len(parts[i])
+		}
+		self.alloc(total) // 拼接结果计入内存配额
+		for i := 0; i < n; i++ {
+			self.stack.pop()
 		}
+		self.stack.push(self.newString(strings.Join(parts, "")))
 	}
 }
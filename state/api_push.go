@@ -3,8 +3,56 @@
 // 将Lua值从外部推入栈顶
 package state
 
-func (self *luaState) PushNil()             { self.stack.push(nil) }
-func (self *luaState) PushBoolean(b bool)   { self.stack.push(b) }
-func (self *luaState) PushInteger(n int64)  { self.stack.push(n) }
-func (self *luaState) PushNumber(n float64) { self.stack.push(n) }
-func (self *luaState) PushString(s string)  { self.stack.push(s) }
+import (
+	"math"
+	"reflect"
+)
+
+func (self *luaState) PushNil()             { self.stack.push(nilValue) }
+func (self *luaState) PushBoolean(b bool)   { self.stack.push(boolValue(b)) }
+func (self *luaState) PushInteger(n int64)  { self.stack.push(integerValue(n)) }
+func (self *luaState) PushNumber(n float64) { self.stack.push(floatValue(n)) }
+func (self *luaState) PushString(s string)  { self.stack.push(self.newString(s)) }
+
+// NewUserdata 创建一个保存value的全量用户数据，并压入栈顶
+func (self *luaState) NewUserdata(value interface{}) {
+	self.stack.push(userdataValue(&userdata{value: value}))
+}
+
+// PushLightUserdata 将p作为轻量用户数据压入栈顶
+func (self *luaState) PushLightUserdata(p interface{}) {
+	self.stack.push(lightUserdataValue(p))
+}
+
+// PushAny 根据Go值的类型压入对应的Lua值
+//  1. nil → nil；bool → 布尔值；
+//  2. 各种整数 → 整数（超出int64范围的无符号整数无法用整数表示，转为浮点数，与Lua中溢出的整数常量一致）；
+//     各种浮点数 → 浮点数；
+//  3. string → 字符串；
+//
+// 以上判断基于reflect.Kind，因此自定义类型（如type Port int）同样适用；其余值包装为全量用户数据
+func (self *luaState) PushAny(v interface{}) {
+	if v == nil {
+		self.PushNil()
+		return
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Bool:
+		self.PushBoolean(rv.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		self.PushInteger(rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if u := rv.Uint(); u <= math.MaxInt64 {
+			self.PushInteger(int64(u))
+		} else {
+			self.PushNumber(float64(u))
+		}
+	case reflect.Float32, reflect.Float64:
+		self.PushNumber(rv.Float())
+	case reflect.String:
+		self.PushString(rv.String())
+	default:
+		self.NewUserdata(v)
+	}
+}
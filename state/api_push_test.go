@@ -0,0 +1,64 @@
+package state
+
+import (
+	. "LuaLight/api"
+	"math"
+	"reflect"
+	"testing"
+)
+
+type port int
+type name string
+
+// PushAny与ToAny互为逆操作：基础类型（包括自定义的具名类型）转换为Lua值后再取回对应的Go类型，
+// 其余值包装为全量用户数据，取回的是原来的值
+func TestPushAnyRoundTrip(t *testing.T) {
+	ptr := &struct{ x int }{1}
+	tests := []struct {
+		in   interface{}
+		typ  LuaType
+		want interface{}
+	}{
+		{nil, LUA_TNIL, nil},
+		{true, LUA_TBOOLEAN, true},
+		{42, LUA_TNUMBER, int64(42)},
+		{int8(-3), LUA_TNUMBER, int64(-3)},
+		{port(8080), LUA_TNUMBER, int64(8080)},
+		{uint8(255), LUA_TNUMBER, int64(255)},
+		{uint64(math.MaxInt64), LUA_TNUMBER, int64(math.MaxInt64)},
+		{uint64(math.MaxInt64) + 1, LUA_TNUMBER, float64(1 << 63)}, // 超出int64范围，转为浮点数
+		{uint64(math.MaxUint64), LUA_TNUMBER, float64(math.MaxUint64)},
+		{float32(1.5), LUA_TNUMBER, 1.5},
+		{math.Inf(-1), LUA_TNUMBER, math.Inf(-1)},
+		{"hi", LUA_TSTRING, "hi"},
+		{name("lua"), LUA_TSTRING, "lua"},
+		{ptr, LUA_TUSERDATA, ptr},
+		{[]int{1, 2}, LUA_TUSERDATA, []int{1, 2}},
+	}
+	for _, test := range tests {
+		ls := New()
+		ls.PushAny(test.in)
+		if ls.GetTop() != 1 {
+			t.Fatalf("PushAny(%#v): top = %d, want 1", test.in, ls.GetTop())
+		}
+		if typ := ls.Type(1); typ != test.typ {
+			t.Errorf("PushAny(%#v) pushed a %s, want %s", test.in, ls.TypeName(typ), ls.TypeName(test.typ))
+		}
+		if got := ls.ToAny(1); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ToAny(PushAny(%#v)) = %#v, want %#v", test.in, got, test.want)
+		}
+	}
+}
+
+// 不超过math.MaxInt64的无符号整数仍然是Lua整数，超出的变成浮点数
+func TestPushAnyUnsignedOverflow(t *testing.T) {
+	ls := New()
+	ls.PushAny(uint64(math.MaxInt64))
+	ls.PushAny(uint64(math.MaxInt64) + 1)
+	if !ls.IsInteger(1) {
+		t.Errorf("MaxInt64 was not pushed as an integer")
+	}
+	if ls.IsInteger(2) || ls.ToNumber(2) != 1<<63 {
+		t.Errorf("MaxInt64+1 = %v, want float 2^63", ls.ToAny(2))
+	}
+}
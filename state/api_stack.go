@@ -14,10 +14,10 @@ func (self *luaState) AbsIndex(idx int) int {
 }
 
 // CheckStack 检查栈剩余空间，确保能容纳n个新元素
-// 空间不足时自动扩容，返回true表示检查/扩容成功（不会失败）
+// 空间不足时自动扩容，返回true表示检查/扩容成功；
+// 扩容后会超过栈的最大容量（见SetStackLimit）时返回false
 func (self *luaState) CheckStack(n int) bool {
-	self.stack.check(n)
-	return true
+	return self.stack.check(n)
 }
 
 // Pop 弹出栈顶n个元素（n≤0时无操作）
@@ -105,7 +105,7 @@ func (self *luaState) SetTop(idx int) {
 	} else if n < 0 {
 		// 补充-n个nil：栈顶从self.stack.top → newTop
 		for i := 0; i > n; i-- {
-			self.stack.push(nil)
+			self.stack.push(nilValue)
 		}
 	}
 }
@@ -0,0 +1,27 @@
+// LuaLight/state/api_userdata.go
+package state
+
+// 全量用户数据的用户值（user value）读写
+
+import . "LuaLight/api"
+
+// SetUserValue 弹出栈顶值，设置为指定索引处全量用户数据的用户值
+// 与lua_setuservalue一致，先按弹出前的栈解析索引（如ud、val依次入栈后用-2指向ud）
+// 指定位置不是全量用户数据时触发panic，此时不弹出栈顶值
+func (self *luaState) SetUserValue(idx int) {
+	ud := self.stack.get(self.stack.absIndex(idx)).toUserdata()
+	if ud == nil {
+		panic("full userdata expected!")
+	}
+	ud.userValue = self.stack.pop()
+}
+
+// GetUserValue 将指定索引处全量用户数据的用户值压入栈顶，返回该值的类型
+// 指定位置不是全量用户数据时触发panic
+func (self *luaState) GetUserValue(idx int) LuaType {
+	if ud := self.stack.get(idx).toUserdata(); ud != nil {
+		self.stack.push(ud.userValue)
+		return typeOf(ud.userValue)
+	}
+	panic("full userdata expected!")
+}
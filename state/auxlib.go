@@ -0,0 +1,175 @@
+// LuaLight/state/auxlib.go
+package state
+
+// 辅助库（lauxlib）的实现，全部基于已有的基础API
+
+import (
+	. "LuaLight/api"
+	"fmt"
+)
+
+// Error2 按格式生成错误信息并抛出（luaL_error）
+// 目前还没有错误处理/函数调用机制，错误统一以panic(字符串)的形式抛出，和其他API保持一致
+// 返回值仅用于保持“return ls.Error2(...)”的写法，实际不会返回
+func (self *luaState) Error2(format string, a ...interface{}) int {
+	panic(fmt.Sprintf(format, a...))
+}
+
+// ArgError 抛出参数错误（luaL_argerror）
+// 完整格式为“bad argument #arg to 'funcname' (extramsg)”；
+// 由于还没有调用帧，拿不到函数名，按官方实现中“取不到调用信息”的分支省略函数名
+func (self *luaState) ArgError(arg int, extraMsg string) int {
+	return self.Error2("bad argument #%d (%s)", arg, extraMsg)
+}
+
+// CheckStack2 确保栈能容纳sz个新值，失败时抛出包装了ErrStackOverflow的错误（luaL_checkstack）
+// msg为附加说明，可以为空
+func (self *luaState) CheckStack2(sz int, msg string) {
+	if !self.CheckStack(sz) {
+		if msg != "" {
+			panic(fmt.Errorf("%w (%s)", ErrStackOverflow, msg))
+		}
+		panic(ErrStackOverflow)
+	}
+}
+
+// ArgCheck 条件不成立时抛出参数错误（luaL_argcheck）
+func (self *luaState) ArgCheck(cond bool, arg int, extraMsg string) {
+	if !cond {
+		self.ArgError(arg, extraMsg)
+	}
+}
+
+// CheckAny 检查第arg个参数是否存在（nil也算存在）（luaL_checkany）
+func (self *luaState) CheckAny(arg int) {
+	if self.Type(arg) == LUA_TNONE {
+		self.ArgError(arg, "value expected")
+	}
+}
+
+// CheckType 检查第arg个参数的类型是否为t（luaL_checktype）
+func (self *luaState) CheckType(arg int, t LuaType) {
+	if self.Type(arg) != t {
+		self.tagError(arg, t)
+	}
+}
+
+// CheckInteger 检查第arg个参数能否转换为整数，并返回转换结果（luaL_checkinteger）
+func (self *luaState) CheckInteger(arg int) int64 {
+	i, ok := self.ToIntegerX(arg)
+	if !ok {
+		self.intError(arg)
+	}
+	return i
+}
+
+// CheckNumber 检查第arg个参数能否转换为浮点数，并返回转换结果（luaL_checknumber）
+func (self *luaState) CheckNumber(arg int) float64 {
+	f, ok := self.ToNumberX(arg)
+	if !ok {
+		self.tagError(arg, LUA_TNUMBER)
+	}
+	return f
+}
+
+// CheckString 检查第arg个参数能否转换为字符串，并返回转换结果（luaL_checkstring）
+// 注意：数值参数会被就地转换为字符串（与ToStringX行为一致）
+func (self *luaState) CheckString(arg int) string {
+	s, ok := self.ToStringX(arg)
+	if !ok {
+		self.tagError(arg, LUA_TSTRING)
+	}
+	return s
+}
+
+// OptInteger 可选整数参数：无值或nil时返回默认值（luaL_optinteger）
+func (self *luaState) OptInteger(arg int, def int64) int64 {
+	if self.IsNoneOrNil(arg) {
+		return def
+	}
+	return self.CheckInteger(arg)
+}
+
+// OptNumber 可选浮点数参数：无值或nil时返回默认值（luaL_optnumber）
+func (self *luaState) OptNumber(arg int, def float64) float64 {
+	if self.IsNoneOrNil(arg) {
+		return def
+	}
+	return self.CheckNumber(arg)
+}
+
+// OptString 可选字符串参数：无值或nil时返回默认值（luaL_optstring）
+func (self *luaState) OptString(arg int, def string) string {
+	if self.IsNoneOrNil(arg) {
+		return def
+	}
+	return self.CheckString(arg)
+}
+
+// TypeName2 返回指定索引处值的类型名称（luaL_typename）
+func (self *luaState) TypeName2(idx int) string {
+	return self.TypeName(self.Type(idx))
+}
+
+// Len2 获取指定索引处值的长度，长度不是整数时抛出错误（luaL_len）
+func (self *luaState) Len2(idx int) int64 {
+	self.Len(idx)
+	i, isNum := self.ToIntegerX(-1)
+	if !isNum {
+		self.Error2("object length is not an integer")
+	}
+	self.Pop(1)
+	return i
+}
+
+// ToString2 将任意值按Lua的规则转换为字符串，压入栈顶并返回（luaL_tolstring）
+// 与ToStringX不同，不会修改原位置的值；暂不支持__tostring/__name元方法
+func (self *luaState) ToString2(idx int) string {
+	switch self.Type(idx) {
+	case LUA_TNUMBER:
+		self.PushString(numberToString(self.stack.get(idx)))
+	case LUA_TSTRING:
+		self.PushValue(idx)
+	case LUA_TBOOLEAN:
+		if self.ToBoolean(idx) {
+			self.PushString("true")
+		} else {
+			self.PushString("false")
+		}
+	case LUA_TNIL:
+		self.PushString("nil")
+	default:
+		p := toPointer(self.stack.get(idx))
+		if isPointer(p) {
+			self.PushString(fmt.Sprintf("%s: %p", self.TypeName2(idx), p))
+		} else {
+			self.PushString(fmt.Sprintf("%s: %v", self.TypeName2(idx), p)) // 保存的不是指针的轻量用户数据
+		}
+	}
+	return self.CheckString(-1)
+}
+
+// intError 整数参数检查失败：区分“是数值但不是整数”和“根本不是数值”两种情况
+func (self *luaState) intError(arg int) {
+	if self.IsNumber(arg) {
+		self.ArgError(arg, "number has no integer representation")
+	} else {
+		self.tagError(arg, LUA_TNUMBER)
+	}
+}
+
+// tagError 类型错误：期望类型由类型标识给出
+func (self *luaState) tagError(arg int, tag LuaType) {
+	self.typeError(arg, self.TypeName(tag))
+}
+
+// typeError 类型错误，错误信息形如“number expected, got nil”
+func (self *luaState) typeError(arg int, tname string) int {
+	var typeArg string // 实际参数的类型名称
+	if self.Type(arg) == LUA_TLIGHTUSERDATA {
+		typeArg = "light userdata" // 错误信息里对轻量用户数据使用专门的名称
+	} else {
+		typeArg = self.TypeName2(arg)
+	}
+	return self.ArgError(arg, tname+" expected, got "+typeArg)
+}
@@ -0,0 +1,46 @@
+// LuaLight/state/lua_limits.go
+package state
+
+// 资源配额：用于沙箱中运行不受信任的脚本
+
+import "errors"
+
+// LUAI_MAXSTACK 栈的默认最大容量（与官方luaconf.h一致）
+const LUAI_MAXSTACK = 1000000
+
+// 超出配额时抛出的错误，以panic的形式抛出，可用recover捕获后通过errors.Is比较
+var (
+	ErrMemoryLimit   = errors.New("not enough memory") // 超出内存配额（见SetMemoryLimit）
+	ErrStackOverflow = errors.New("stack overflow")    // 栈超出最大容量（见SetStackLimit、CheckStack2）
+)
+
+// SetStackLimit 设置栈的最大容量（元素个数），超出后CheckStack返回false
+// limit≤0时恢复为默认值LUAI_MAXSTACK；小于当前栈顶时取当前栈顶，已有的元素不受影响，只是不能再压入新值
+func (self *luaState) SetStackLimit(limit int) {
+	if limit <= 0 {
+		limit = LUAI_MAXSTACK
+	}
+	if limit < self.stack.top {
+		limit = self.stack.top
+	}
+	self.stack.limit = limit
+}
+
+// SetMemoryLimit 设置内存配额（字节），limit≤0表示不限制
+// 统计的是虚拟机自己创建的字符串（拼接、数值转字符串等）累计分配的字节数，是近似值
+func (self *luaState) SetMemoryLimit(limit int) {
+	self.memLimit = limit
+}
+
+// MemoryUsed 返回目前累计记入配额的字节数
+func (self *luaState) MemoryUsed() int {
+	return self.memUsed
+}
+
+// alloc 记录一次n字节的分配，超出配额时抛出ErrMemoryLimit（本次分配不计入）
+func (self *luaState) alloc(n int) {
+	if self.memLimit > 0 && self.memUsed+n > self.memLimit {
+		panic(ErrMemoryLimit)
+	}
+	self.memUsed += n
+}
@@ -0,0 +1,75 @@
+package state
+
+import (
+	. "LuaLight/api"
+	"errors"
+	"testing"
+)
+
+// catch 执行f，返回其panic抛出的错误（没有panic时返回nil）
+func catch(f func()) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err, _ = r.(error)
+			if err == nil {
+				panic(r)
+			}
+		}
+	}()
+	f()
+	return nil
+}
+
+func TestStackLimit(t *testing.T) {
+	var ls LuaState = New() // 配额设置是api.LuaState的一部分
+	ls.SetStackLimit(5)
+	if !ls.CheckStack(5) || ls.CheckStack(6) {
+		t.Errorf("CheckStack with limit 5: want 5 ok and 6 refused")
+	}
+	err := catch(func() { ls.CheckStack2(6, "too many values") })
+	if !errors.Is(err, ErrStackOverflow) || err.Error() != "stack overflow (too many values)" {
+		t.Errorf("CheckStack2 error = %v, want ErrStackOverflow", err)
+	}
+	if err := catch(func() { ls.CheckStack2(6, "") }); err != ErrStackOverflow {
+		t.Errorf("CheckStack2 error = %v, want ErrStackOverflow", err)
+	}
+
+	// 低于当前栈顶的限制取当前栈顶：已有的值保留，CheckStack(0)仍然成功
+	for i := 0; i < 3; i++ {
+		ls.PushInteger(int64(i))
+	}
+	ls.SetStackLimit(1)
+	if !ls.CheckStack(0) || ls.CheckStack(1) {
+		t.Errorf("CheckStack below top: want 0 ok and 1 refused")
+	}
+	if ls.GetTop() != 3 {
+		t.Errorf("top = %d, want 3", ls.GetTop())
+	}
+	ls.SetStackLimit(0)
+	if !ls.CheckStack(100) {
+		t.Errorf("CheckStack(100) refused after restoring the default limit")
+	}
+}
+
+// 超出内存配额时Concat不修改栈：栈顶和操作数（包括数值操作数）都保持原样
+func TestConcatMemoryLimit(t *testing.T) {
+	var ls LuaState = New()
+	ls.PushString("abc")
+	ls.PushInteger(42)
+	ls.SetMemoryLimit(ls.MemoryUsed() + 4)
+	if err := catch(func() { ls.Concat(2) }); err != ErrMemoryLimit {
+		t.Fatalf("Concat error = %v, want ErrMemoryLimit", err)
+	}
+	if ls.GetTop() != 2 {
+		t.Fatalf("top = %d after failed Concat, want 2", ls.GetTop())
+	}
+	if ls.ToString(1) != "abc" || !ls.IsInteger(2) || ls.ToInteger(2) != 42 {
+		t.Errorf("stack = [%v %v], want [abc 42]", ls.ToAny(1), ls.ToAny(2))
+	}
+
+	ls.SetMemoryLimit(0)
+	ls.Concat(2)
+	if ls.GetTop() != 1 || ls.ToString(1) != "abc42" {
+		t.Errorf("Concat after lifting the limit = %v", ls.ToAny(-1))
+	}
+}
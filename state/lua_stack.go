@@ -4,9 +4,11 @@ package state
 // luaStack 定义Lua虚拟机的栈结构（底层存储核心）
 // slots：存储栈元素的底层数组（0索引），元素类型为luaValue（支持Lua所有基础类型）
 // top：栈顶的绝对索引（Lua栈索引，从1开始），栈为空时top=0，有n个元素时top=n
+// limit：栈允许的最大容量，check扩容时不会超过该值
 type luaStack struct {
 	slots []luaValue // 栈元素存储容器（Go数组，0索引）
 	top   int        // 栈顶的Lua绝对索引（非数组下标）
+	limit int        // 栈的最大容量（元素个数）
 }
 
 // newLuaStack 创建指定初始容量的Lua栈
@@ -15,17 +17,23 @@ func newLuaStack(size int) *luaStack {
 	return &luaStack{
 		slots: make([]luaValue, size), // 初始化底层数组
 		top:   0,                      // 初始栈空，栈顶索引为0
+		limit: LUAI_MAXSTACK,          // 默认最大容量
 	}
 }
 
 // check 检查栈剩余空间，确保能容纳至少n个新元素
 // 若空闲空间不足，自动扩容底层数组（追加nil），避免push时溢出
-func (self *luaStack) check(n int) {
+// 扩容后会超过最大容量limit时不扩容，返回false
+func (self *luaStack) check(n int) bool {
+	if n > self.limit-self.top {
+		return false // 超出最大容量
+	}
 	free := len(self.slots) - self.top // 计算剩余空闲空间（数组总长度 - 当前栈顶索引）
 	// 空闲不足时，循环追加nil扩容，直到能容纳n个新元素
 	for i := free; i < n; i++ {
-		self.slots = append(self.slots, nil)
+		self.slots = append(self.slots, nilValue)
 	}
+	return true
 }
 
 // push 将值压入栈顶
@@ -46,9 +54,9 @@ func (self *luaStack) pop() luaValue {
 	if self.top < 1 {
 		panic("stack underflow!") // 栈下溢：无元素可弹出
 	}
-	self.top--                  // 栈顶索引下移一位
-	val := self.slots[self.top] // 读取栈顶元素（数组下标=top）
-	self.slots[self.top] = nil  // 清空原栈顶位置（避免悬空引用）
+	self.top--                      // 栈顶索引下移一位
+	val := self.slots[self.top]     // 读取栈顶元素（数组下标=top）
+	self.slots[self.top] = nilValue // 清空原栈顶位置（避免悬空引用）
 	return val
 }
 
@@ -88,7 +96,7 @@ func (self *luaStack) get(idx int) luaValue {
 	if absIdx > 0 && absIdx <= self.top {
 		return self.slots[absIdx-1] // 数组下标 = 绝对索引 - 1
 	}
-	return nil // 无效索引返回nil
+	return nilValue // 无效索引返回nil
 }
 
 // set 根据索引（相对/绝对）往栈中写入值
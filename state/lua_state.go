@@ -3,11 +3,15 @@ package state
 
 //接口的实现
 type luaState struct {
-	stack *luaStack
+	stack    *luaStack
+	strt     *stringTable // 短字符串表
+	memUsed  int          // 已记入内存配额的字节数
+	memLimit int          // 内存配额（字节），≤0表示不限制
 }
 
 func New() *luaState {
 	return &luaState{
 		stack: newLuaStack(20),
+		strt:  newStringTable(),
 	}
 }
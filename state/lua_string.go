@@ -0,0 +1,138 @@
+// LuaLight/state/lua_string.go
+package state
+
+// 字符串对象与短字符串内部化（对应官方lstring.c）
+// 长度不超过LUAI_MAXSHORTLEN的字符串在每个虚拟机中只保留一份，并缓存哈希值，
+// 相等比较只需比较指针；字符串表只持有弱引用，不再使用的字符串照常被GC回收
+
+import (
+	"math/rand"
+	"weak"
+)
+
+const (
+	LUAI_MAXSHORTLEN = 40 // 短字符串的最大长度（与官方实现一致）
+	LUAI_HASHLIMIT   = 5  // 计算哈希时最多采样2^LUAI_HASHLIMIT个字节左右
+	MINSTRTABSIZE    = 128
+)
+
+// luaString 字符串对象（字符串值的载荷）
+// 短字符串经过内部化，同样内容的只有一个对象，hash为创建时计算的哈希值，字符串表查找和扩容都直接使用；
+// 长字符串每次新建，不计算哈希值（hash为0）
+type luaString struct {
+	s    string // 字符串内容
+	hash uint32 // 缓存的哈希值（只有短字符串有）
+}
+
+// stringTable 短字符串表：按哈希值分桶的开放哈希表（对应官方的stringtable）
+// 表中只保存弱引用：字符串值（luaValue.p）持有*luaString的强引用，
+// 某个字符串不再被任何值引用时由Go的GC回收，表中对应的节点在查找或扩容时顺便清除
+type stringTable struct {
+	hash []*stringNode // 桶数组，长度总是2的幂
+	nuse int           // 节点数量（包括还没来得及清除的已回收字符串）
+	seed uint32        // 哈希种子（每个虚拟机随机生成，避免哈希碰撞攻击）
+}
+
+// stringNode 字符串表中的节点
+type stringNode struct {
+	ts   weak.Pointer[luaString] // 弱引用，字符串被回收后Value()返回nil
+	next *stringNode             // 同一个桶里的下一个节点
+}
+
+// newStringTable 创建字符串表
+func newStringTable() *stringTable {
+	return &stringTable{
+		hash: make([]*stringNode, MINSTRTABSIZE),
+		seed: rand.Uint32(),
+	}
+}
+
+// luaS_hash 计算字符串的哈希值（与官方luaS_hash算法一致）
+// 长字符串只按步长采样部分字节
+func luaS_hash(str string, seed uint32) uint32 {
+	l := len(str)
+	h := seed ^ uint32(l)
+	step := (l >> LUAI_HASHLIMIT) + 1
+	for ; l >= step; l -= step {
+		h ^= (h << 5) + (h >> 2) + uint32(str[l-1])
+	}
+	return h
+}
+
+// intern 返回内容为s的短字符串，表中已有时直接复用，否则新建并加入表中
+func (self *stringTable) intern(s string) *luaString {
+	h := luaS_hash(s, self.seed)
+	for list := &self.hash[h&uint32(len(self.hash)-1)]; *list != nil; {
+		node := *list
+		ts := node.ts.Value()
+		if ts == nil { // 已被回收，顺便从链表中删除
+			*list = node.next
+			self.nuse--
+			continue
+		}
+		if ts.hash == h && ts.s == s {
+			return ts // 已存在
+		}
+		list = &node.next
+	}
+	if self.nuse >= len(self.hash) {
+		self.sweep()
+		if self.nuse >= len(self.hash)/2 {
+			self.resize(len(self.hash) * 2) // 清除后仍然较满时扩容一倍
+		}
+	}
+	ts := &luaString{s: s, hash: h}
+	list := &self.hash[h&uint32(len(self.hash)-1)]
+	*list = &stringNode{ts: weak.Make(ts), next: *list}
+	self.nuse++
+	return ts
+}
+
+// sweep 清除所有已被回收的字符串对应的节点，剩下的字符串很少时缩小桶数组（对应官方的checkSizes）
+func (self *stringTable) sweep() {
+	for i := range self.hash {
+		for list := &self.hash[i]; *list != nil; {
+			if node := *list; node.ts.Value() == nil {
+				*list = node.next
+				self.nuse--
+			} else {
+				list = &node.next
+			}
+		}
+	}
+	size := len(self.hash)
+	for size > MINSTRTABSIZE && self.nuse < size/4 {
+		size /= 2
+	}
+	if size != len(self.hash) {
+		self.resize(size)
+	}
+}
+
+// resize 把桶数组调整为newSize个桶，利用字符串缓存的哈希值重新分桶，已被回收的字符串的节点直接丢弃
+func (self *stringTable) resize(newSize int) {
+	newHash := make([]*stringNode, newSize)
+	for _, node := range self.hash {
+		for node != nil {
+			next := node.next
+			if ts := node.ts.Value(); ts == nil {
+				self.nuse--
+			} else {
+				list := &newHash[ts.hash&uint32(newSize-1)]
+				node.next = *list
+				*list = node
+			}
+			node = next
+		}
+	}
+	self.hash = newHash
+}
+
+// newString 创建字符串值：短字符串经过内部化，长字符串新建一个不做内部化的对象
+// 字符串值都应通过newString创建，相等比较依赖于短字符串一定经过内部化
+func (self *luaState) newString(s string) luaValue {
+	if len(s) <= LUAI_MAXSHORTLEN {
+		return luaValue{tag: tagString, p: self.strt.intern(s)}
+	}
+	return luaValue{tag: tagString, p: &luaString{s: s}}
+}
@@ -0,0 +1,69 @@
+package state
+
+import (
+	. "LuaLight/api"
+	"fmt"
+	"runtime"
+	"testing"
+)
+
+func TestInternSharesShortStrings(t *testing.T) {
+	ls := New()
+	ls.PushString("hello")
+	ls.PushString("hel" + "lo")
+	runtime.GC() // 仍在栈上的字符串不会被回收
+	ls.PushString("hello")
+	a, b, c := ls.stack.get(1).p, ls.stack.get(2).p, ls.stack.get(3).p
+	if a == nil || a != b || a != c {
+		t.Errorf("short strings not shared: %p %p %p", a, b, c)
+	}
+	if !ls.Compare(1, 3, LUA_OPEQ) {
+		t.Errorf("interned strings compare unequal")
+	}
+
+	long := fmt.Sprintf("%0*d", LUAI_MAXSHORTLEN+1, 0)
+	ls.PushString(long)
+	ls.PushString(long)
+	if ls.stack.get(-1).p == ls.stack.get(-2).p {
+		t.Errorf("long string was interned")
+	}
+	if !ls.Compare(-1, -2, LUA_OPEQ) {
+		t.Errorf("equal long strings compare unequal")
+	}
+}
+
+// 不再被引用的短字符串应当被回收，字符串表不会无限增长
+func TestInternedStringsAreCollected(t *testing.T) {
+	ls := New()
+	const n = 100000
+	for i := 0; i < n; i++ {
+		ls.PushString(fmt.Sprintf("s%d", i))
+		ls.Pop(1)
+	}
+	runtime.GC()
+	ls.strt.sweep()
+	if ls.strt.nuse > n/100 {
+		t.Errorf("%d of %d unreferenced strings still in the table", ls.strt.nuse, n)
+	}
+	if size := len(ls.strt.hash); size > n/10 {
+		t.Errorf("table still has %d buckets after sweeping", size)
+	}
+}
+
+// 扩容按字符串缓存的哈希值重新分桶，之后仍然能找到原来的字符串
+func TestInternSurvivesResize(t *testing.T) {
+	ls := New()
+	const n = 4 * MINSTRTABSIZE
+	ls.CheckStack(n)
+	for i := 0; i < n; i++ {
+		ls.PushString(fmt.Sprintf("k%d", i))
+	}
+	if len(ls.strt.hash) <= MINSTRTABSIZE {
+		t.Fatalf("table did not grow: %d buckets", len(ls.strt.hash))
+	}
+	for i := 0; i < n; i++ {
+		if ts := ls.strt.intern(fmt.Sprintf("k%d", i)); ts != ls.stack.get(i+1).p {
+			t.Fatalf("k%d was interned twice after resizing", i)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+// LuaLight/state/lua_userdata.go
+package state
+
+import "reflect"
+
+// userdata 全量用户数据：由虚拟机创建并管理，用于把宿主的Go值（数据库句柄、socket等）交给脚本
+// 每个全量用户数据都是独立的对象，按引用比较相等
+type userdata struct {
+	value     interface{} // 宿主持有的Go值
+	userValue luaValue    // 关联的用户值（lua_setuservalue/lua_getuservalue），默认为nil
+}
+
+// userdataValue 构造全量用户数据值
+func userdataValue(ud *userdata) luaValue {
+	return luaValue{tag: tagUserdata, p: ud}
+}
+
+// lightUserdataValue 构造轻量用户数据值：仅仅是宿主传入的一个值（对应C API中的void*），不归虚拟机管理
+// 两个轻量用户数据保存的值相等时即相等，因此p只能是指针一类的值（见isLightPointer），否则直接panic
+func lightUserdataValue(p interface{}) luaValue {
+	if p != nil && !isLightPointer(p) {
+		panic("light userdata must be a pointer!")
+	}
+	return luaValue{tag: tagLightUserdata, p: p}
+}
+
+// isLightPointer 判断p能否作为轻量用户数据：指针、unsafe.Pointer、uintptr、chan
+// 这些类型的==比较永远不会panic；reflect的Comparable()不够，例如接口字段中保存了slice的结构体
+// 也算Comparable，比较时却会panic，map、slice、func则根本不能比较
+func isLightPointer(p interface{}) bool {
+	switch reflect.TypeOf(p).Kind() {
+	case reflect.Ptr, reflect.UnsafePointer, reflect.Uintptr, reflect.Chan:
+		return true
+	default:
+		return false
+	}
+}
+
+// toUserdata 取出全量用户数据（不是全量用户数据时返回nil）
+func (self luaValue) toUserdata() *userdata {
+	if self.tag == tagUserdata {
+		return self.p.(*userdata)
+	}
+	return nil
+}
+
+// isPointer 判断toPointer的结果能否用%p格式化（指针、map、slice、chan、func等引用类型）
+func isPointer(p interface{}) bool {
+	if p == nil {
+		return false
+	}
+	switch reflect.TypeOf(p).Kind() {
+	case reflect.Ptr, reflect.UnsafePointer, reflect.Map, reflect.Slice, reflect.Chan, reflect.Func:
+		return true
+	default:
+		return false
+	}
+}
+
+// toPointer 返回用户数据对应的“地址”，用于生成形如“userdata: 0x...”的字符串
+// 全量用户数据返回*userdata，轻量用户数据返回其保存的值
+func toPointer(val luaValue) interface{} {
+	return val.p
+}
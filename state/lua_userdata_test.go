@@ -0,0 +1,87 @@
+package state
+
+import (
+	. "LuaLight/api"
+	"testing"
+	"unsafe"
+)
+
+// mustPanic 检查f是否panic
+func mustPanic(t *testing.T, name string, f func()) {
+	t.Helper()
+	defer func() {
+		if recover() == nil {
+			t.Errorf("%s: no panic", name)
+		}
+	}()
+	f()
+}
+
+func TestLightUserdataEquality(t *testing.T) {
+	x, y := new(int), new(int)
+	ch := make(chan int)
+	ls := New()
+	for _, p := range []interface{}{x, x, y, unsafe.Pointer(x), uintptr(1), uintptr(1), ch, ch, nil} {
+		ls.PushLightUserdata(p)
+	}
+	equal := [][2]int{{1, 2}, {5, 6}, {7, 8}}
+	unequal := [][2]int{{1, 3}, {1, 4}, {5, 1}, {9, 1}}
+	for _, c := range equal {
+		if !ls.Compare(c[0], c[1], LUA_OPEQ) {
+			t.Errorf("light userdata %d and %d compare unequal", c[0], c[1])
+		}
+	}
+	for _, c := range unequal {
+		if ls.Compare(c[0], c[1], LUA_OPEQ) {
+			t.Errorf("light userdata %d and %d compare equal", c[0], c[1])
+		}
+	}
+}
+
+// 只接受指针一类的值：以下的值用==比较时会panic，压栈时就应该拒绝
+func TestLightUserdataRejectsNonPointers(t *testing.T) {
+	type boxed struct{ v interface{} }
+	for name, p := range map[string]interface{}{
+		"slice":                 []int{1},
+		"map":                   map[int]int{},
+		"func":                  func() {},
+		"struct holding slice":  boxed{[]int{1}},
+		"struct holding number": boxed{1},
+		"int":                   1,
+	} {
+		ls := New()
+		mustPanic(t, name, func() { ls.PushLightUserdata(p) })
+		if ls.GetTop() != 0 {
+			t.Errorf("%s: top = %d after failed push, want 0", name, ls.GetTop())
+		}
+	}
+}
+
+// ud、val依次入栈后，SetUserValue(-2)中的-2按弹出val之前的栈解析，指向ud
+func TestSetUserValueRelativeIndex(t *testing.T) {
+	ls := New()
+	ls.NewUserdata("handle")
+	ls.PushInteger(42)
+	ls.SetUserValue(-2)
+	if ls.GetTop() != 1 {
+		t.Fatalf("top = %d after SetUserValue, want 1", ls.GetTop())
+	}
+	if tp := ls.GetUserValue(-1); tp != LUA_TNUMBER || ls.ToInteger(-1) != 42 {
+		t.Errorf("user value = %s %v, want number 42", ls.TypeName(tp), ls.ToAny(-1))
+	}
+}
+
+// 指定位置不是全量用户数据时panic，栈保持不变
+func TestSetUserValueNotUserdata(t *testing.T) {
+	x := new(int)
+	ls := New()
+	ls.PushLightUserdata(x)
+	ls.PushString("v")
+	mustPanic(t, "SetUserValue(-2)", func() { ls.SetUserValue(-2) })
+	if ls.GetTop() != 2 {
+		t.Fatalf("top = %d after failed SetUserValue, want 2", ls.GetTop())
+	}
+	if ls.ToUserdata(1) != x || ls.ToString(2) != "v" {
+		t.Errorf("stack = [%v %v], want [%p v]", ls.ToAny(1), ls.ToAny(2), x)
+	}
+}
@@ -5,33 +5,95 @@ package state
 import (
 	. "LuaLight/api"
 	"LuaLight/number"
+	"math"
+	"strconv"
 )
 
-type luaValue interface{}
+// 值的类型标签：比LuaType更细，区分整数/浮点数、全量/轻量用户数据
+const (
+	tagNil           = iota // nil（luaValue的零值就是nil）
+	tagBoolean              // 布尔值，载荷存放在n中（0=false，1=true）
+	tagInteger              // 整数，载荷存放在n中
+	tagFloat                // 浮点数，载荷（IEEE 754位模式）存放在n中
+	tagString               // 字符串，载荷（*luaString，见lua_string.go）存放在p中
+	tagLightUserdata        // 轻量用户数据，载荷存放在p中
+	tagUserdata             // 全量用户数据，载荷（*userdata）存放在p中
+)
+
+// luaValue Lua值的带标签表示
+// 布尔值、整数、浮点数直接内联在n中，压栈和算术运算不会像interface{}那样在堆上装箱；
+// 字符串、用户数据等需要GC管理的对象只通过p引用
+type luaValue struct {
+	tag byte        // 类型标签（tagXXX）
+	n   uint64      // 内联载荷：布尔值/整数/浮点数
+	p   interface{} // 对象载荷：*luaString、*userdata或轻量用户数据保存的值
+}
+
+var nilValue = luaValue{} // nil值
+
+// boolValue 构造布尔值
+func boolValue(b bool) luaValue {
+	if b {
+		return luaValue{tag: tagBoolean, n: 1}
+	}
+	return luaValue{tag: tagBoolean}
+}
+
+// integerValue 构造整数值
+func integerValue(i int64) luaValue {
+	return luaValue{tag: tagInteger, n: uint64(i)}
+}
+
+// floatValue 构造浮点数值
+func floatValue(f float64) luaValue {
+	return luaValue{tag: tagFloat, n: math.Float64bits(f)}
+}
+
+// boolean 取出布尔值载荷（调用方需保证tag为tagBoolean）
+func (self luaValue) boolean() bool {
+	return self.n != 0
+}
+
+// integer 取出整数载荷（调用方需保证tag为tagInteger）
+func (self luaValue) integer() int64 {
+	return int64(self.n)
+}
+
+// float 取出浮点数载荷（调用方需保证tag为tagFloat）
+func (self luaValue) float() float64 {
+	return math.Float64frombits(self.n)
+}
+
+// str 取出字符串载荷（调用方需保证tag为tagString）
+func (self luaValue) str() string {
+	return self.p.(*luaString).s
+}
 
 func typeOf(val luaValue) LuaType {
-	switch val.(type) {
-	case nil:
+	switch val.tag {
+	case tagNil:
 		return LUA_TNIL
-	case bool:
+	case tagBoolean:
 		return LUA_TBOOLEAN
-	case int64:
-		return LUA_TNUMBER
-	case float64:
+	case tagInteger, tagFloat:
 		return LUA_TNUMBER
-	case string:
+	case tagString:
 		return LUA_TSTRING
+	case tagUserdata:
+		return LUA_TUSERDATA
+	case tagLightUserdata:
+		return LUA_TLIGHTUSERDATA
 	default:
 		panic("todo!")
 	}
 }
 
 func convertToBoolean(val luaValue) bool {
-	switch x := val.(type) {
-	case nil:
+	switch val.tag {
+	case tagNil:
 		return false
-	case bool:
-		return x
+	case tagBoolean:
+		return val.boolean()
 	default:
 		return true
 	}
@@ -39,13 +101,13 @@ func convertToBoolean(val luaValue) bool {
 
 // 任意值转化为浮点数
 func convertToFloat(val luaValue) (float64, bool) {
-	switch x := val.(type) {
-	case float64:
-		return x, true
-	case int64:
-		return float64(x), true
-	case string:
-		return number.ParseFloat(x)
+	switch val.tag {
+	case tagFloat:
+		return val.float(), true
+	case tagInteger:
+		return float64(val.integer()), true
+	case tagString:
+		return number.ParseFloat(val.str())
 	default:
 		return 0, false
 	}
@@ -53,18 +115,26 @@ func convertToFloat(val luaValue) (float64, bool) {
 
 // 任意值转化为整数
 func convertToInteger(val luaValue) (int64, bool) {
-	switch x := val.(type) {
-	case int64:
-		return x, true
-	case float64:
-		return number.FloatToInteger(x)
-	case string:
-		return _stringToInteger(x)
+	switch val.tag {
+	case tagInteger:
+		return val.integer(), true
+	case tagFloat:
+		return number.FloatToInteger(val.float())
+	case tagString:
+		return _stringToInteger(val.str())
 	default:
 		return 0, false
 	}
 }
 
+// 数值转化为字符串（ToStringX和ToString2共用，保证同一个值只有一种字符串形式）
+func numberToString(val luaValue) string {
+	if val.tag == tagInteger {
+		return strconv.FormatInt(val.integer(), 10)
+	}
+	return number.FloatToString(val.float())
+}
+
 func _stringToInteger(s string) (int64, bool) {
 	if i, ok := number.ParseInteger(s); ok {
 		return i, true
@@ -0,0 +1,116 @@
+package state
+
+import (
+	. "LuaLight/api"
+	"testing"
+	"unsafe"
+)
+
+// 带标签的luaValue把整数、浮点数内联保存，压栈和算术运算都不应该在堆上分配内存
+
+var arithOps = []struct {
+	name string
+	op   ArithOp
+}{
+	{"Add", LUA_OPADD},
+	{"Sub", LUA_OPSUB},
+	{"Mul", LUA_OPMUL},
+	{"Mod", LUA_OPMOD},
+	{"Pow", LUA_OPPOW},
+	{"Div", LUA_OPDIV},
+	{"IDiv", LUA_OPIDIV},
+	{"Unm", LUA_OPUNM},
+}
+
+var bitwiseOps = []struct {
+	name string
+	op   ArithOp
+}{
+	{"Band", LUA_OPBAND},
+	{"Shl", LUA_OPSHL},
+	{"Bnot", LUA_OPBNOT},
+}
+
+func pushIntegers(ls *luaState) {
+	ls.PushInteger(12345)
+	ls.PushInteger(6)
+}
+
+func pushFloats(ls *luaState) {
+	ls.PushNumber(3.25)
+	ls.PushNumber(1.5)
+}
+
+// arithOnce 压入两个操作数，做一次运算，然后清空栈（一元运算只使用栈顶的操作数）
+func arithOnce(ls *luaState, push func(*luaState), op ArithOp) {
+	push(ls)
+	ls.Arith(op)
+	ls.SetTop(0)
+}
+
+func TestArithAllocs(t *testing.T) {
+	check := func(name string, push func(*luaState), op ArithOp) {
+		ls := New()
+		arithOnce(ls, push, op) // 预热，排除一次性的分配
+		allocs := testing.AllocsPerRun(1000, func() {
+			arithOnce(ls, push, op)
+		})
+		if allocs != 0 {
+			t.Errorf("%s: %v allocs per op, want 0", name, allocs)
+		}
+	}
+	for _, c := range arithOps {
+		check("Int"+c.name, pushIntegers, c.op)
+		check("Float"+c.name, pushFloats, c.op)
+	}
+	for _, c := range bitwiseOps {
+		check("Int"+c.name, pushIntegers, c.op)
+	}
+}
+
+func benchmarkArith(b *testing.B, push func(*luaState), op ArithOp) {
+	ls := New()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		arithOnce(ls, push, op)
+	}
+}
+
+func BenchmarkArithInt(b *testing.B) {
+	for _, c := range append(arithOps, bitwiseOps...) {
+		b.Run(c.name, func(b *testing.B) {
+			benchmarkArith(b, pushIntegers, c.op)
+		})
+	}
+}
+
+func BenchmarkArithFloat(b *testing.B) {
+	for _, c := range arithOps {
+		b.Run(c.name, func(b *testing.B) {
+			benchmarkArith(b, pushFloats, c.op)
+		})
+	}
+}
+
+// luaValue是栈槽的类型，每次压栈、复制都要整体拷贝：标签和内联载荷之外只能有一个对象引用
+func TestValueSize(t *testing.T) {
+	if size := unsafe.Sizeof(luaValue{}); size > 32 {
+		t.Errorf("luaValue is %d bytes, want at most 32", size)
+	}
+}
+
+// BenchmarkStackOps 只搬动栈上已有的值（PushValue、Replace、Rotate、Copy），不创建新值
+func BenchmarkStackOps(b *testing.B) {
+	ls := New()
+	ls.PushInteger(1)
+	ls.PushNumber(2.5)
+	ls.PushString("short")
+	ls.NewUserdata(nil)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		ls.PushValue(1)
+		ls.Replace(2)
+		ls.Rotate(1, 1)
+		ls.Copy(3, 4)
+	}
+}
@@ -0,0 +1,180 @@
+// LuaLight/vm/cfg/cfg.go
+package cfg
+
+// 字节码控制流图（CFG）：把函数原型的指令序列划分为基本块，并在此基础上提供
+// 支配树、循环识别、寄存器活跃性分析、到达定值分析以及DOT格式输出，供优化器、检查工具、反编译器共用
+
+import (
+	"LuaLight/binchunk"
+	. "LuaLight/vm"
+)
+
+// Block 基本块：只能从第一条指令进入、从最后一条指令离开的一段连续指令
+type Block struct {
+	Index     int      // 基本块序号（按指令顺序排列，0号为入口块）
+	Start     int      // 第一条指令的pc
+	End       int      // 最后一条指令的下一个pc，即指令范围为[Start, End)
+	Succs     []*Block // 后继块（顺序执行的后继在前，跳转目标在后）
+	Preds     []*Block // 前驱块
+	Reachable bool     // 是否能从入口块到达
+
+	Idom     *Block   // 直接支配者（入口块和不可达的块为nil）
+	Children []*Block // 支配树中的子节点（被该块直接支配的块）
+	Loop     *Loop    // 包含该块的最内层循环（不在循环中为nil）
+}
+
+// Graph 单个函数原型的控制流图
+type Graph struct {
+	Proto  *binchunk.Prototype
+	Blocks []*Block // 所有基本块（按指令顺序），Blocks[0]为入口块
+	Loops  []*Loop  // 所有自然循环（外层循环排在内层循环之前）
+
+	blockOf []int    // pc → 所在基本块序号
+	rpo     []*Block // 可达基本块的逆后序
+}
+
+// Build 为函数原型构建控制流图，同时计算支配树和循环（不包含子函数，子函数需单独构建）
+func Build(proto *binchunk.Prototype) *Graph {
+	g := &Graph{Proto: proto}
+	g.splitBlocks()
+	g.connect()
+	g.computeRPO()
+	g.computeDominators()
+	g.findLoops()
+	return g
+}
+
+// BlockOf 返回pc所在的基本块
+func (self *Graph) BlockOf(pc int) *Block {
+	return self.Blocks[self.blockOf[pc]]
+}
+
+// Entry 返回入口块
+func (self *Graph) Entry() *Block {
+	return self.Blocks[0]
+}
+
+// JumpTarget 对于带跳转偏移的指令（JMP/FORPREP/FORLOOP/TFORLOOP），返回其跳转目标
+func JumpTarget(i Instruction, pc int) (int, bool) {
+	switch i.Opcode() {
+	case OP_JMP, OP_FORPREP, OP_FORLOOP, OP_TFORLOOP:
+		_, sbx := i.AsBx()
+		return pc + 1 + sbx, true
+	default:
+		return 0, false
+	}
+}
+
+// SkipsNext 判断指令是否可能跳过下一条指令
+// 条件测试指令（EQ/LT/LE/TEST/TESTSET）以及C非0的LOADBOOL都会跳过下一条指令
+func SkipsNext(i Instruction) bool {
+	if i.TestFlag() {
+		return true
+	}
+	if i.Opcode() == OP_LOADBOOL {
+		_, _, c := i.ABC()
+		return c != 0
+	}
+	return false
+}
+
+// Successors 返回pc处指令执行后可能执行的下一条指令（顺序执行的后继在前）
+// RETURN没有后继；TAILCALL调用Go函数时会继续执行下一条RETURN，因此后继是pc+1
+func Successors(proto *binchunk.Prototype, pc int) []int {
+	i := Instruction(proto.Code[pc])
+	switch i.Opcode() {
+	case OP_RETURN:
+		return nil
+	case OP_JMP, OP_FORPREP: // 无条件跳转（FORPREP跳到FORLOOP）
+		target, _ := JumpTarget(i, pc)
+		return []int{target}
+	case OP_FORLOOP, OP_TFORLOOP: // 继续循环时跳回循环体，否则顺序执行
+		target, _ := JumpTarget(i, pc)
+		return []int{pc + 1, target}
+	}
+	if SkipsNext(i) {
+		if i.Opcode() == OP_LOADBOOL {
+			return []int{pc + 2}
+		}
+		return []int{pc + 1, pc + 2}
+	}
+	return []int{pc + 1}
+}
+
+// endsBlock 判断指令是否结束一个基本块（跳转、条件测试、返回）
+func endsBlock(i Instruction) bool {
+	switch i.Opcode() {
+	case OP_JMP, OP_FORPREP, OP_FORLOOP, OP_TFORLOOP, OP_RETURN, OP_TAILCALL:
+		return true
+	default:
+		return SkipsNext(i)
+	}
+}
+
+// splitBlocks 找出所有基本块的首条指令（入口、跳转目标、结束基本块的指令的下一条），划分基本块
+func (self *Graph) splitBlocks() {
+	code := self.Proto.Code
+	leaders := make([]bool, len(code)+1)
+	if len(code) > 0 {
+		leaders[0] = true
+	}
+	for pc := range code {
+		if !endsBlock(Instruction(code[pc])) {
+			continue
+		}
+		leaders[pc+1] = true
+		for _, succ := range Successors(self.Proto, pc) {
+			if succ >= 0 && succ <= len(code) {
+				leaders[succ] = true
+			}
+		}
+	}
+
+	self.blockOf = make([]int, len(code))
+	for pc := 0; pc < len(code); pc++ {
+		if leaders[pc] {
+			self.Blocks = append(self.Blocks, &Block{Index: len(self.Blocks), Start: pc})
+		}
+		b := self.Blocks[len(self.Blocks)-1]
+		b.End = pc + 1
+		self.blockOf[pc] = b.Index
+	}
+}
+
+// connect 根据每个基本块最后一条指令的后继，连接基本块
+func (self *Graph) connect() {
+	for _, b := range self.Blocks {
+		for _, succ := range Successors(self.Proto, b.End-1) {
+			if succ < 0 || succ >= len(self.Proto.Code) {
+				continue // 越界的跳转（损坏的字节码），忽略
+			}
+			s := self.BlockOf(succ)
+			b.Succs = append(b.Succs, s)
+			s.Preds = append(s.Preds, b)
+		}
+	}
+}
+
+// computeRPO 从入口块深度优先遍历，标记可达块并计算逆后序
+func (self *Graph) computeRPO() {
+	if len(self.Blocks) == 0 {
+		return
+	}
+	var postorder []*Block
+	var visit func(b *Block)
+	visit = func(b *Block) {
+		b.Reachable = true
+		for _, s := range b.Succs {
+			if !s.Reachable {
+				visit(s)
+			}
+		}
+		postorder = append(postorder, b)
+	}
+	visit(self.Entry())
+
+	self.rpo = make([]*Block, len(postorder))
+	for i, b := range postorder {
+		self.rpo[len(postorder)-1-i] = b
+	}
+}
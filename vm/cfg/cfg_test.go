@@ -0,0 +1,277 @@
+package cfg
+
+import (
+	"LuaLight/binchunk"
+	. "LuaLight/vm"
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+// build 用手工编码的指令构建控制流图
+func build(numParams, maxStackSize int, code ...Instruction) *Graph {
+	p := &binchunk.Prototype{
+		Source:       "@t.lua",
+		NumParams:    byte(numParams),
+		MaxStackSize: byte(maxStackSize),
+	}
+	for _, i := range code {
+		p.Code = append(p.Code, uint32(i))
+	}
+	return Build(p)
+}
+
+func regs(rs ...int) RegSet {
+	var set RegSet
+	for _, r := range rs {
+		set.Add(r)
+	}
+	return set
+}
+
+// shape 把基本块的划分和连接写成 {起始pc: 后继块的起始pc} 的形式
+func shape(g *Graph) map[int][]int {
+	m := make(map[int][]int)
+	for _, b := range g.Blocks {
+		succs := []int{}
+		for _, s := range b.Succs {
+			succs = append(succs, s.Start)
+		}
+		m[b.Start] = succs
+	}
+	return m
+}
+
+func checkShape(t *testing.T, g *Graph, want map[int][]int) {
+	t.Helper()
+	if got := shape(g); !reflect.DeepEqual(got, want) {
+		t.Errorf("blocks = %v, want %v", got, want)
+	}
+}
+
+func checkIdom(t *testing.T, g *Graph, want map[int]int) {
+	t.Helper()
+	for start, idom := range want {
+		b := g.BlockOf(start)
+		if b.Idom == nil || b.Idom.Start != idom {
+			t.Errorf("idom of block %d = %v, want block %d", start, b.Idom, idom)
+		}
+	}
+}
+
+func checkLive(t *testing.T, name string, got, want RegSet) {
+	t.Helper()
+	if got != want {
+		t.Errorf("%s = %v, want %v", name, got.Regs(), want.Regs())
+	}
+}
+
+func checkReaching(t *testing.T, r *ReachingDefs, pc, reg int, want []Def) {
+	t.Helper()
+	if got := r.ReachingBefore(pc, reg); !reflect.DeepEqual(got, want) {
+		t.Errorf("defs of R%d before pc %d = %v, want %v", reg, pc, got, want)
+	}
+}
+
+func checkLoops(t *testing.T, g *Graph, n int) {
+	t.Helper()
+	if len(g.Loops) != n {
+		t.Fatalf("%d loops, want %d", len(g.Loops), n)
+	}
+}
+
+func checkLoop(t *testing.T, loop *Loop, header int, latches, blocks []int) {
+	t.Helper()
+	var gotLatches, gotBlocks []int
+	for _, b := range loop.Latches {
+		gotLatches = append(gotLatches, b.Start)
+	}
+	for _, b := range loop.Blocks {
+		gotBlocks = append(gotBlocks, b.Start)
+	}
+	if loop.Header.Start != header || !reflect.DeepEqual(gotLatches, latches) || !reflect.DeepEqual(gotBlocks, blocks) {
+		t.Errorf("loop header=%d latches=%v blocks=%v, want %d %v %v",
+			loop.Header.Start, gotLatches, gotBlocks, header, latches, blocks)
+	}
+}
+
+func TestEmptyProto(t *testing.T) {
+	g := build(0, 2)
+	if len(g.Blocks) != 0 || len(g.Loops) != 0 {
+		t.Errorf("blocks=%d loops=%d, want none", len(g.Blocks), len(g.Loops))
+	}
+	g.Liveness()
+	if defs := g.ReachingDefs().Defs; len(defs) != 0 {
+		t.Errorf("defs = %v, want none", defs)
+	}
+	if err := g.WriteDOT(new(bytes.Buffer)); err != nil {
+		t.Error(err)
+	}
+}
+
+// for i = a, b, c do local x = i end
+func TestNumericFor(t *testing.T) {
+	g := build(0, 5,
+		CreateABx(OP_LOADK, 0, 0),
+		CreateABx(OP_LOADK, 1, 1),
+		CreateABx(OP_LOADK, 2, 2),
+		CreateAsBx(OP_FORPREP, 0, 1),  // → 5
+		CreateABC(OP_MOVE, 4, 3, 0),   // 循环体读取循环变量R3
+		CreateAsBx(OP_FORLOOP, 0, -2), // → 4
+		CreateABC(OP_RETURN, 0, 1, 0),
+	)
+	checkShape(t, g, map[int][]int{0: {5}, 4: {5}, 5: {6, 4}, 6: {}})
+	checkIdom(t, g, map[int]int{4: 5, 5: 0, 6: 5})
+	checkLoops(t, g, 1)
+	checkLoop(t, g.Loops[0], 5, []int{4}, []int{4, 5})
+
+	// R3只在FORLOOP跳回循环体时写入：在循环体中活跃，在FORLOOP之前不活跃
+	l := g.Liveness()
+	checkLive(t, "LiveIn(body)", l.LiveIn[g.BlockOf(4).Index], regs(0, 1, 2, 3))
+	checkLive(t, "LiveIn(FORLOOP)", l.LiveIn[g.BlockOf(5).Index], regs(0, 1, 2))
+	checkLive(t, "LiveOut(FORLOOP)", l.LiveOut[g.BlockOf(5).Index], regs(0, 1, 2))
+	checkLive(t, "LiveAfter(FORPREP)", l.LiveAfter(3), regs(0, 1, 2))
+
+	r := g.ReachingDefs()
+	checkReaching(t, r, 4, 3, []Def{{5, 3}})
+	checkReaching(t, r, 5, 0, []Def{{3, 0}, {5, 0}})
+	checkReaching(t, r, 6, 3, []Def{{5, 3}}) // 上一轮循环写入的值
+	checkReaching(t, r, 6, 0, []Def{{5, 0}})
+}
+
+// for k, v in f, s, ctl do local x = v end（迭代器、状态、控制变量是参数R0～R2）
+func TestGenericFor(t *testing.T) {
+	g := build(3, 7,
+		CreateAsBx(OP_JMP, 0, 1),        // → 2
+		CreateABC(OP_MOVE, 6, 4, 0),     // 循环体读取v（R4）
+		CreateABC(OP_TFORCALL, 0, 0, 2), // R3, R4 := R0(R1, R2)
+		CreateAsBx(OP_TFORLOOP, 2, -3),  // → 1
+		CreateABC(OP_RETURN, 0, 1, 0),
+	)
+	checkShape(t, g, map[int][]int{0: {2}, 1: {2}, 2: {4, 1}, 4: {}})
+	checkIdom(t, g, map[int]int{1: 2, 2: 0, 4: 2})
+	checkLoops(t, g, 1)
+	checkLoop(t, g.Loops[0], 2, []int{1}, []int{1, 2})
+
+	l := g.Liveness()
+	checkLive(t, "LiveIn(body)", l.LiveIn[g.BlockOf(1).Index], regs(0, 1, 2, 4))
+	checkLive(t, "LiveIn(TFORCALL)", l.LiveIn[g.BlockOf(2).Index], regs(0, 1, 2))
+	// 控制变量R2沿回边由TFORLOOP写入，之前的值到此不再活跃
+	checkLive(t, "LiveOut(TFORLOOP)", l.LiveOut[g.BlockOf(2).Index], regs(0, 1, 4))
+	checkLive(t, "LiveAfter(TFORCALL)", l.LiveAfter(2), regs(0, 1, 3, 4))
+
+	r := g.ReachingDefs()
+	checkReaching(t, r, 1, 2, []Def{{3, 2}})
+	checkReaching(t, r, 2, 2, []Def{{-1, 2}, {3, 2}})
+	// 循环结束时R2可能是参数，也可能是之前某一轮TFORLOOP写入的值
+	checkReaching(t, r, 4, 2, []Def{{-1, 2}, {3, 2}})
+	// 迭代器的栈帧覆盖了R5以上的寄存器，循环体写入的R6不能活过TFORCALL
+	checkReaching(t, r, 2, 6, []Def{{1, 6}})
+	checkReaching(t, r, 3, 6, nil)
+}
+
+// TESTSET沿不同的边写入与否、LOADBOOL跳过下一条指令，以及不可达的结尾
+func TestSkipsAndUnreachableTail(t *testing.T) {
+	g := build(2, 3,
+		CreateABC(OP_TESTSET, 2, 0, 1),  // if R0 then R2 := R0 else pc++
+		CreateAsBx(OP_JMP, 0, 1),        // → 3
+		CreateABC(OP_LOADBOOL, 2, 0, 1), // R2 := false; pc++ → 4
+		CreateABC(OP_LOADBOOL, 2, 1, 0), // R2 := true
+		CreateABC(OP_RETURN, 2, 2, 0),
+		CreateABC(OP_RETURN, 0, 1, 0), // 不可达
+	)
+	checkShape(t, g, map[int][]int{0: {1, 2}, 1: {3}, 2: {4}, 3: {4}, 4: {}, 5: {}})
+	checkIdom(t, g, map[int]int{1: 0, 2: 0, 3: 1, 4: 0})
+	checkLoops(t, g, 0)
+	tail := g.BlockOf(5)
+	if tail.Reachable || tail.Idom != nil || g.Dominates(g.Entry(), tail) {
+		t.Errorf("tail: reachable=%v idom=%v", tail.Reachable, tail.Idom)
+	}
+
+	l := g.Liveness()
+	checkLive(t, "LiveBefore(TESTSET)", l.LiveBefore(0), regs(0))
+	checkLive(t, "LiveOut(TESTSET)", l.LiveOut[g.Entry().Index], RegSet{})
+	checkLive(t, "LiveIn(RETURN)", l.LiveIn[g.BlockOf(4).Index], regs(2))
+	checkLive(t, "LiveIn(tail)", l.LiveIn[tail.Index], RegSet{})
+
+	r := g.ReachingDefs()
+	checkReaching(t, r, 1, 2, []Def{{0, 2}}) // 条件成立，TESTSET写入R2
+	checkReaching(t, r, 2, 2, nil)           // 条件不成立，跳过JMP
+	checkReaching(t, r, 4, 2, []Def{{2, 2}, {3, 2}})
+}
+
+// 被调用函数的栈帧从R(A+1)开始：CALL之后参数寄存器和多余的返回值寄存器都不再有值
+func TestCallClobbersArgs(t *testing.T) {
+	g := build(1, 4,
+		CreateABC(OP_MOVE, 1, 0, 0),
+		CreateABC(OP_MOVE, 2, 0, 0),
+		CreateABC(OP_CALL, 0, 3, 2), // R0 := R0(R1, R2)
+		CreateABC(OP_RETURN, 0, 2, 0),
+	)
+	l := g.Liveness()
+	checkLive(t, "LiveBefore(CALL)", l.LiveBefore(2), regs(0, 1, 2))
+	checkLive(t, "LiveAfter(CALL)", l.LiveAfter(2), regs(0))
+	checkLive(t, "LiveBefore(MOVE)", l.LiveBefore(0), regs(0))
+
+	r := g.ReachingDefs()
+	checkReaching(t, r, 2, 1, []Def{{0, 1}})
+	checkReaching(t, r, 3, 0, []Def{{2, 0}})
+	checkReaching(t, r, 3, 1, nil)
+	checkReaching(t, r, 3, 2, nil)
+}
+
+// for i = a, b, c do for j = a, b, c do local x = j end end
+func TestNestedLoops(t *testing.T) {
+	g := build(0, 9,
+		CreateABx(OP_LOADK, 0, 0),
+		CreateABx(OP_LOADK, 1, 1),
+		CreateABx(OP_LOADK, 2, 2),
+		CreateAsBx(OP_FORPREP, 0, 6), // → 10
+		CreateABx(OP_LOADK, 4, 0),
+		CreateABx(OP_LOADK, 5, 1),
+		CreateABx(OP_LOADK, 6, 2),
+		CreateAsBx(OP_FORPREP, 4, 1), // → 9
+		CreateABC(OP_MOVE, 8, 7, 0),
+		CreateAsBx(OP_FORLOOP, 4, -2), // → 8
+		CreateAsBx(OP_FORLOOP, 0, -7), // → 4
+		CreateABC(OP_RETURN, 0, 1, 0),
+	)
+	checkShape(t, g, map[int][]int{0: {10}, 4: {9}, 8: {9}, 9: {10, 8}, 10: {11, 4}, 11: {}})
+	checkLoops(t, g, 2)
+	outer, inner := g.Loops[0], g.Loops[1]
+	checkLoop(t, outer, 10, []int{9}, []int{4, 8, 9, 10})
+	checkLoop(t, inner, 9, []int{8}, []int{8, 9})
+	if outer.Parent != nil || outer.Depth != 1 {
+		t.Errorf("outer loop: parent=%v depth=%d, want nil 1", outer.Parent, outer.Depth)
+	}
+	if inner.Parent != outer || inner.Depth != 2 {
+		t.Errorf("inner loop: parent=%v depth=%d, want outer 2", inner.Parent, inner.Depth)
+	}
+	for pc, want := range map[int]*Loop{0: nil, 4: outer, 8: inner, 9: inner, 10: outer, 11: nil} {
+		if got := g.BlockOf(pc).Loop; got != want {
+			t.Errorf("innermost loop of pc %d = %v, want %v", pc, got, want)
+		}
+	}
+	if !outer.Contains(g.BlockOf(8)) || inner.Contains(g.BlockOf(4)) {
+		t.Errorf("Contains: outer should contain the inner body, inner should not contain the outer body")
+	}
+}
+
+// CONCAT把中间结果写回R(B)～R(C)：拼接之后这些寄存器原来的值不再可用
+func TestConcatClobbersOperands(t *testing.T) {
+	g := build(2, 4,
+		CreateABC(OP_MOVE, 2, 0, 0),
+		CreateABC(OP_MOVE, 3, 1, 0),
+		CreateABC(OP_CONCAT, 0, 2, 3), // R0 := R2 .. R3
+		CreateABC(OP_RETURN, 0, 0, 0), // return R0, ...（到栈顶）
+	)
+	l := g.Liveness()
+	checkLive(t, "LiveBefore(CONCAT)", l.LiveBefore(2), regs(1, 2, 3))
+	checkLive(t, "LiveBefore(MOVE)", l.LiveBefore(0), regs(0, 1))
+
+	r := g.ReachingDefs()
+	checkReaching(t, r, 3, 0, []Def{{2, 0}})
+	checkReaching(t, r, 3, 1, []Def{{-1, 1}})
+	checkReaching(t, r, 3, 2, nil)
+	checkReaching(t, r, 3, 3, nil)
+}
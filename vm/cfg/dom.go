@@ -0,0 +1,165 @@
+// LuaLight/vm/cfg/dom.go
+package cfg
+
+// 支配树与自然循环
+// 支配者采用Cooper、Harvey、Kennedy的迭代算法（A Simple, Fast Dominance Algorithm）：
+// 按逆后序反复求前驱的公共支配者，直到不再变化
+
+import "sort"
+
+// Loop 自然循环：由回边（尾块→循环头，且循环头支配尾块）确定，同一循环头的多条回边合并为一个循环
+type Loop struct {
+	Header  *Block   // 循环头
+	Latches []*Block // 回边的尾块（跳回循环头的块）
+	Blocks  []*Block // 循环包含的所有块（按序号排列，包括循环头）
+	Parent  *Loop    // 直接外层循环（最外层循环为nil）
+	Depth   int      // 嵌套深度（最外层循环为1）
+}
+
+// Contains 判断块是否在循环中
+func (self *Loop) Contains(b *Block) bool {
+	i := sort.Search(len(self.Blocks), func(i int) bool {
+		return self.Blocks[i].Index >= b.Index
+	})
+	return i < len(self.Blocks) && self.Blocks[i] == b
+}
+
+// Dominates 判断块a是否支配块b（从入口到b的每条路径都经过a；块支配自身）
+// 不可达的块不被任何块支配
+func (self *Graph) Dominates(a, b *Block) bool {
+	if !a.Reachable || !b.Reachable {
+		return false
+	}
+	for ; b != nil; b = b.Idom {
+		if b == a {
+			return true
+		}
+	}
+	return false
+}
+
+// computeDominators 计算每个可达块的直接支配者，并建立支配树
+func (self *Graph) computeDominators() {
+	if len(self.rpo) == 0 {
+		return
+	}
+	order := make([]int, len(self.Blocks)) // 块序号 → 在逆后序中的位置
+	for i, b := range self.rpo {
+		order[b.Index] = i
+	}
+	idom := make([]*Block, len(self.Blocks))
+	entry := self.Entry()
+	idom[entry.Index] = entry
+
+	intersect := func(b1, b2 *Block) *Block {
+		for b1 != b2 {
+			for order[b1.Index] > order[b2.Index] {
+				b1 = idom[b1.Index]
+			}
+			for order[b2.Index] > order[b1.Index] {
+				b2 = idom[b2.Index]
+			}
+		}
+		return b1
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for _, b := range self.rpo[1:] {
+			var newIdom *Block
+			for _, p := range b.Preds {
+				if idom[p.Index] == nil {
+					continue // 前驱还没有处理过（或不可达）
+				}
+				if newIdom == nil {
+					newIdom = p
+				} else {
+					newIdom = intersect(p, newIdom)
+				}
+			}
+			if idom[b.Index] != newIdom {
+				idom[b.Index] = newIdom
+				changed = true
+			}
+		}
+	}
+
+	for _, b := range self.rpo[1:] {
+		b.Idom = idom[b.Index]
+		b.Idom.Children = append(b.Idom.Children, b)
+	}
+}
+
+// findLoops 根据回边找出所有自然循环，并计算循环的嵌套关系
+func (self *Graph) findLoops() {
+	headers := map[*Block]*Loop{}
+	for _, b := range self.rpo {
+		for _, s := range b.Succs {
+			if !self.Dominates(s, b) {
+				continue
+			}
+			loop := headers[s]
+			if loop == nil {
+				loop = &Loop{Header: s}
+				headers[s] = loop
+				self.Loops = append(self.Loops, loop)
+			}
+			loop.Latches = append(loop.Latches, b)
+		}
+	}
+
+	for _, loop := range self.Loops {
+		loop.collectBlocks()
+	}
+
+	// 外层循环包含的块一定比内层循环多，按块数从多到少排序后，
+	// 每个循环的直接外层循环就是排在它前面、包含它的循环头的最后一个循环
+	sort.SliceStable(self.Loops, func(i, j int) bool {
+		return len(self.Loops[i].Blocks) > len(self.Loops[j].Blocks)
+	})
+	for i, loop := range self.Loops {
+		for j := i - 1; j >= 0; j-- {
+			if self.Loops[j].Contains(loop.Header) {
+				loop.Parent = self.Loops[j]
+				break
+			}
+		}
+		if loop.Parent == nil {
+			loop.Depth = 1
+		} else {
+			loop.Depth = loop.Parent.Depth + 1
+		}
+		for _, b := range loop.Blocks {
+			b.Loop = loop // 内层循环排在后面，最终留下的是最内层循环
+		}
+	}
+}
+
+// collectBlocks 从各个回边的尾块出发逆着控制流查找，直到循环头为止，经过的块都属于循环
+func (self *Loop) collectBlocks() {
+	in := map[*Block]bool{self.Header: true}
+	var work []*Block
+	for _, latch := range self.Latches {
+		if !in[latch] {
+			in[latch] = true
+			work = append(work, latch)
+		}
+	}
+	for len(work) > 0 {
+		b := work[len(work)-1]
+		work = work[:len(work)-1]
+		for _, p := range b.Preds {
+			if p.Reachable && !in[p] {
+				in[p] = true
+				work = append(work, p)
+			}
+		}
+	}
+
+	for b := range in {
+		self.Blocks = append(self.Blocks, b)
+	}
+	sort.Slice(self.Blocks, func(i, j int) bool {
+		return self.Blocks[i].Index < self.Blocks[j].Index
+	})
+}
@@ -0,0 +1,79 @@
+// LuaLight/vm/cfg/dot.go
+package cfg
+
+// 以Graphviz的DOT格式输出控制流图，可用`dot -Tsvg`等命令生成图片
+// 每个基本块是一个节点，列出块内的指令；跳转目标的边用实线，顺序执行的边用虚线，回边标红
+
+import (
+	. "LuaLight/vm"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// WriteDOT 把控制流图以DOT格式写入w
+func (self *Graph) WriteDOT(w io.Writer) error {
+	var sb strings.Builder
+	proto := self.Proto
+	fmt.Fprintf(&sb, "digraph %q {\n", fmt.Sprintf("%s:%d,%d", proto.SourceName(), proto.LineDefined, proto.LastLineDefined))
+	sb.WriteString("\tnode [shape=box, fontname=monospace];\n")
+
+	for _, b := range self.Blocks {
+		var label strings.Builder
+		fmt.Fprintf(&label, "B%d", b.Index)
+		if b.Loop != nil && b.Loop.Header == b {
+			fmt.Fprintf(&label, " (loop header, depth %d)", b.Loop.Depth)
+		}
+		label.WriteString(`\l`)
+		for pc := b.Start; pc < b.End; pc++ {
+			label.WriteString(escapeLabel(instString(Instruction(proto.Code[pc]), pc)))
+			label.WriteString(`\l`)
+		}
+		style := ""
+		if !b.Reachable {
+			style = ", style=dashed, fontcolor=gray"
+		}
+		fmt.Fprintf(&sb, "\tB%d [label=\"%s\"%s];\n", b.Index, label.String(), style)
+	}
+
+	for _, b := range self.Blocks {
+		for _, s := range b.Succs {
+			var attrs []string
+			if s.Start == b.End && !isJump(Instruction(proto.Code[b.End-1])) {
+				attrs = append(attrs, "style=dashed") // 顺序执行
+			}
+			if s.Reachable && self.Dominates(s, b) {
+				attrs = append(attrs, "color=red") // 回边
+			}
+			if len(attrs) > 0 {
+				fmt.Fprintf(&sb, "\tB%d -> B%d [%s];\n", b.Index, s.Index, strings.Join(attrs, ", "))
+			} else {
+				fmt.Fprintf(&sb, "\tB%d -> B%d;\n", b.Index, s.Index)
+			}
+		}
+	}
+	sb.WriteString("}\n")
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// isJump 判断指令是否为无条件跳转（跳到下一条指令的JMP也不算顺序执行）
+func isJump(i Instruction) bool {
+	op := i.Opcode()
+	return op == OP_JMP || op == OP_FORPREP
+}
+
+// instString 把指令格式化为“pc: 指令名 操作数”，跳转指令附带跳转目标
+func instString(i Instruction, pc int) string {
+	s := fmt.Sprintf("%d: %-9s %s", pc, i.OpName(), i.Operands())
+	if target, ok := JumpTarget(i, pc); ok {
+		s += fmt.Sprintf(" ; to %d", target)
+	}
+	return s
+}
+
+// escapeLabel 转义DOT标签中的特殊字符
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s)
+}
@@ -0,0 +1,80 @@
+// LuaLight/vm/cfg/liveness.go
+package cfg
+
+// 寄存器活跃性分析（逆向数据流）：
+// LiveOut(b) = ∪ LiveIn(s)，s为b的后继
+// LiveIn(b)  = Uses(b) ∪ (LiveOut(b) - Kills(b))，Kills为一定会写入（Defs）或破坏（Clobbers）的寄存器
+// 只在部分路径上写入的寄存器（MayDefs）不会结束之前值的活跃范围，
+// 但FORLOOP、TFORLOOP、TESTSET沿特定的边一定会写入，在这条边上单独处理
+
+import . "LuaLight/vm"
+
+// Liveness 活跃性分析结果
+type Liveness struct {
+	g       *Graph
+	LiveIn  []RegSet // 按块序号：进入块时活跃的寄存器
+	LiveOut []RegSet // 按块序号：离开块时活跃的寄存器
+}
+
+// Liveness 对控制流图做寄存器活跃性分析
+func (self *Graph) Liveness() *Liveness {
+	n := len(self.Blocks)
+	l := &Liveness{
+		g:       self,
+		LiveIn:  make([]RegSet, n),
+		LiveOut: make([]RegSet, n),
+	}
+	// 逆向分析按后序（逆后序倒过来）处理收敛最快；不可达块不在逆后序中，排在最后一并计算
+	order := make([]*Block, 0, n)
+	for i := len(self.rpo) - 1; i >= 0; i-- {
+		order = append(order, self.rpo[i])
+	}
+	for _, b := range self.Blocks {
+		if !b.Reachable {
+			order = append(order, b)
+		}
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, b := range order {
+			var out RegSet
+			last := b.End - 1
+			for _, s := range b.Succs {
+				in := l.LiveIn[s.Index]
+				if reg, succ, ok := branchDef(Instruction(self.Proto.Code[last]), last); ok && succ == s.Start {
+					var def RegSet
+					def.Add(reg)
+					in = in.Minus(def) // 沿这条边走时寄存器一定会被写入
+				}
+				out = out.Union(in)
+			}
+			in := l.transfer(b.Start, b.End, out)
+			if in != l.LiveIn[b.Index] || out != l.LiveOut[b.Index] {
+				l.LiveIn[b.Index], l.LiveOut[b.Index] = in, out
+				changed = true
+			}
+		}
+	}
+	return l
+}
+
+// transfer 已知执行完[start, end)中的指令后活跃的寄存器为live，逆着执行这些指令，返回执行之前活跃的寄存器
+func (self *Liveness) transfer(start, end int, live RegSet) RegSet {
+	for pc := end - 1; pc >= start; pc-- {
+		e := InstEffect(self.g.Proto, pc)
+		live = live.Minus(e.Kills()).Union(e.Uses)
+	}
+	return live
+}
+
+// LiveBefore 返回执行pc处指令之前活跃的寄存器
+func (self *Liveness) LiveBefore(pc int) RegSet {
+	e := InstEffect(self.g.Proto, pc)
+	return self.LiveAfter(pc).Minus(e.Kills()).Union(e.Uses)
+}
+
+// LiveAfter 返回执行pc处指令之后活跃的寄存器
+func (self *Liveness) LiveAfter(pc int) RegSet {
+	b := self.g.BlockOf(pc)
+	return self.transfer(pc+1, b.End, self.LiveOut[b.Index])
+}
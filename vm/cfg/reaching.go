@@ -0,0 +1,211 @@
+// LuaLight/vm/cfg/reaching.go
+package cfg
+
+// 到达定值分析（正向数据流）：
+// In(b)  = ∪ Out(p)，p为b的前驱
+// Out(b) = Gen(b) ∪ (In(b) - Kill(b))
+// 一定会写入（Defs）或被破坏（Clobbers，如CALL之后被调用函数占用过的寄存器）的寄存器，之前的定值全部失效；
+// 只在部分路径上写入的（MayDefs）只增加新定值，
+// 其中FORLOOP、TFORLOOP、TESTSET的写入在控制流图的边上处理
+
+import . "LuaLight/vm"
+
+// Def 一处定值：pc处的指令写入了寄存器Reg
+// 函数的固定参数在进入函数时就有值，记为PC为-1的定值
+type Def struct {
+	PC  int
+	Reg int
+}
+
+// defSet 定值集合（按定值序号的位图）
+type defSet []uint64
+
+func newDefSet(n int) defSet {
+	return make(defSet, (n+63)/64)
+}
+
+func (self defSet) add(d int) {
+	self[d>>6] |= 1 << uint(d&63)
+}
+
+func (self defSet) remove(d int) {
+	self[d>>6] &^= 1 << uint(d&63)
+}
+
+func (self defSet) has(d int) bool {
+	return self[d>>6]&(1<<uint(d&63)) != 0
+}
+
+func (self defSet) equal(other defSet) bool {
+	for i := range self {
+		if self[i] != other[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// ReachingDefs 到达定值分析结果
+type ReachingDefs struct {
+	g     *Graph
+	Defs  []Def    // 函数中的所有定值（序号即在此数组中的下标）
+	in    []defSet // 按块序号：到达块首的定值
+	out   []defSet // 按块序号：到达块尾的定值
+	byReg [][]int  // 寄存器 → 写入该寄存器的所有定值的序号
+	byPC  [][]int  // pc → 该指令产生的定值的序号
+}
+
+// ReachingDefs 对控制流图做到达定值分析
+func (self *Graph) ReachingDefs() *ReachingDefs {
+	r := &ReachingDefs{g: self}
+	r.collectDefs()
+
+	n := len(self.Blocks)
+	r.in = make([]defSet, n)
+	r.out = make([]defSet, n)
+	for i := range self.Blocks {
+		r.in[i] = newDefSet(len(r.Defs))
+		r.out[i] = newDefSet(len(r.Defs))
+	}
+	if n == 0 {
+		return r
+	}
+
+	entry := newDefSet(len(r.Defs)) // 参数的定值
+	for d, def := range r.Defs {
+		if def.PC < 0 {
+			entry.add(d)
+		}
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for _, b := range self.Blocks {
+			in := newDefSet(len(r.Defs))
+			if b == self.Entry() {
+				copy(in, entry)
+			}
+			for _, p := range b.Preds {
+				for i, w := range r.edgeOut(p, b) {
+					in[i] |= w
+				}
+			}
+			out := r.transfer(b.Start, b.End, in)
+			if !in.equal(r.in[b.Index]) || !out.equal(r.out[b.Index]) {
+				r.in[b.Index], r.out[b.Index] = in, out
+				changed = true
+			}
+		}
+	}
+	return r
+}
+
+// edgeOut 返回沿边p→s到达s的定值
+// p的最后一条指令只在走向特定后继时才写入的寄存器（见branchDef）：transfer不产生这个定值，
+// 走这条边时才覆盖该寄存器之前的定值并加入新定值；走其他边时之前到达的定值（包括上一轮循环的）原样保留
+func (self *ReachingDefs) edgeOut(p, s *Block) defSet {
+	last := p.End - 1
+	d, succ, ok := self.branchDef(last)
+	if !ok || succ != s.Start {
+		return self.out[p.Index]
+	}
+	out := newDefSet(len(self.Defs))
+	copy(out, self.out[p.Index])
+	for _, other := range self.byReg[self.Defs[d].Reg] {
+		out.remove(other)
+	}
+	out.add(d)
+	return out
+}
+
+// branchDef 如果pc处的指令只在走向特定后继时才写入寄存器，返回该定值的序号和对应的后继pc
+func (self *ReachingDefs) branchDef(pc int) (d, succ int, ok bool) {
+	reg, succ, ok := branchDef(Instruction(self.g.Proto.Code[pc]), pc)
+	if !ok {
+		return 0, 0, false
+	}
+	for _, d := range self.byPC[pc] {
+		if self.Defs[d].Reg == reg {
+			return d, succ, true
+		}
+	}
+	return 0, 0, false
+}
+
+// collectDefs 为参数和每条指令写入的每个寄存器编号
+func (self *ReachingDefs) collectDefs() {
+	proto := self.g.Proto
+	self.byReg = make([][]int, 256)
+	self.byPC = make([][]int, len(proto.Code))
+	newDef := func(pc, reg int) int {
+		d := len(self.Defs)
+		self.Defs = append(self.Defs, Def{PC: pc, Reg: reg})
+		self.byReg[reg] = append(self.byReg[reg], d)
+		return d
+	}
+
+	for reg := 0; reg < int(proto.NumParams); reg++ {
+		newDef(-1, reg)
+	}
+	for pc := range proto.Code {
+		e := InstEffect(proto, pc)
+		for _, reg := range e.Defs.Union(e.MayDefs).Regs() {
+			self.byPC[pc] = append(self.byPC[pc], newDef(pc, reg))
+		}
+	}
+}
+
+// transfer 从定值集合in出发，正向执行[start, end)中的指令，返回新的定值集合（不修改in）
+func (self *ReachingDefs) transfer(start, end int, in defSet) defSet {
+	out := newDefSet(len(self.Defs))
+	copy(out, in)
+	for pc := start; pc < end; pc++ {
+		e := InstEffect(self.g.Proto, pc)
+		for _, reg := range e.Kills().Regs() {
+			for _, d := range self.byReg[reg] {
+				out.remove(d)
+			}
+		}
+		branch, _, hasBranch := self.branchDef(pc)
+		for _, d := range self.byPC[pc] {
+			if !hasBranch || d != branch { // 只在特定边上产生的定值由edgeOut处理
+				out.add(d)
+			}
+		}
+	}
+	return out
+}
+
+// ReachingBefore 返回执行pc处指令之前，寄存器reg可能来自的所有定值
+// 返回空时说明reg在此处没有有效的值（从未赋值，或已被函数调用破坏）
+func (self *ReachingDefs) ReachingBefore(pc, reg int) []Def {
+	b := self.g.BlockOf(pc)
+	set := self.transfer(b.Start, pc, self.in[b.Index])
+	var defs []Def
+	for _, d := range self.byReg[reg] {
+		if set.has(d) {
+			defs = append(defs, self.Defs[d])
+		}
+	}
+	return defs
+}
+
+// ReachingIn 返回到达块b入口的所有定值
+func (self *ReachingDefs) ReachingIn(b *Block) []Def {
+	return self.list(self.in[b.Index])
+}
+
+// ReachingOut 返回到达块b出口的所有定值
+func (self *ReachingDefs) ReachingOut(b *Block) []Def {
+	return self.list(self.out[b.Index])
+}
+
+func (self *ReachingDefs) list(set defSet) []Def {
+	var defs []Def
+	for d, def := range self.Defs {
+		if set.has(d) {
+			defs = append(defs, def)
+		}
+	}
+	return defs
+}
@@ -0,0 +1,253 @@
+// LuaLight/vm/cfg/regs.go
+package cfg
+
+// 每条指令读写的寄存器（对应Lua 5.3各条指令的语义）
+// 操作数个数取决于栈顶的指令（CALL/RETURN/SETLIST的B为0、CALL/VARARG结果个数不定）无法静态确定，
+// 保守地认为涉及从起始寄存器到MaxStackSize-1的所有寄存器；
+// 被调用函数的栈帧与调用者的寄存器重叠（从R(A+1)开始），调用之后这些寄存器里原来的值都被破坏
+
+import (
+	"LuaLight/binchunk"
+	. "LuaLight/vm"
+	"math/bits"
+)
+
+// RegSet 寄存器集合（Lua函数最多使用256个寄存器，用位图表示）
+type RegSet [4]uint64
+
+// Add 把寄存器r加入集合
+func (self *RegSet) Add(r int) {
+	self[r>>6] |= 1 << uint(r&63)
+}
+
+// AddRange 把寄存器from到to（包括to）加入集合
+func (self *RegSet) AddRange(from, to int) {
+	for r := from; r <= to; r++ {
+		self.Add(r)
+	}
+}
+
+// Has 判断寄存器r是否在集合中
+func (self RegSet) Has(r int) bool {
+	return self[r>>6]&(1<<uint(r&63)) != 0
+}
+
+// Union 返回两个集合的并集
+func (self RegSet) Union(other RegSet) RegSet {
+	for i := range self {
+		self[i] |= other[i]
+	}
+	return self
+}
+
+// Minus 返回在self中但不在other中的寄存器
+func (self RegSet) Minus(other RegSet) RegSet {
+	for i := range self {
+		self[i] &^= other[i]
+	}
+	return self
+}
+
+// Len 返回集合中寄存器的个数
+func (self RegSet) Len() int {
+	n := 0
+	for _, w := range self {
+		n += bits.OnesCount64(w)
+	}
+	return n
+}
+
+// Regs 按从小到大的顺序返回集合中的寄存器
+func (self RegSet) Regs() []int {
+	var regs []int
+	for i, w := range self {
+		for w != 0 {
+			regs = append(regs, i<<6+bits.TrailingZeros64(w))
+			w &= w - 1
+		}
+	}
+	return regs
+}
+
+// Effect 指令对寄存器的读写
+type Effect struct {
+	Uses     RegSet // 读取的寄存器
+	Defs     RegSet // 一定会写入的寄存器
+	MayDefs  RegSet // 只在部分执行路径上写入（或写入个数不定）的寄存器，不会覆盖之前的定值
+	Clobbers RegSet // 被写入无意义值的寄存器（如被调用函数的栈帧占用），原来的值不再可用，但不算定值
+}
+
+// Kills 返回执行后原来的值一定不再可用的寄存器
+func (self Effect) Kills() RegSet {
+	return self.Defs.Union(self.Clobbers)
+}
+
+// InstEffect 返回pc处指令读写的寄存器
+func InstEffect(proto *binchunk.Prototype, pc int) Effect {
+	var e Effect
+	i := Instruction(proto.Code[pc])
+	top := int(proto.MaxStackSize) - 1 // 栈顶不确定时保守地取最大寄存器
+	useRK := func(rk int) {
+		if rk <= 0xFF { // 不是常量
+			e.Uses.Add(rk)
+		}
+	}
+
+	switch i.Opcode() {
+	case OP_MOVE, OP_UNM, OP_BNOT, OP_NOT, OP_LEN: // R(A) := op R(B)
+		a, b, _ := i.ABC()
+		e.Uses.Add(b)
+		e.Defs.Add(a)
+	case OP_LOADK, OP_LOADKX, OP_LOADBOOL, OP_GETUPVAL, OP_NEWTABLE:
+		a, _, _ := i.ABC()
+		e.Defs.Add(a)
+	case OP_LOADNIL: // R(A), R(A+1), ..., R(A+B) := nil
+		a, b, _ := i.ABC()
+		e.Defs.AddRange(a, a+b)
+	case OP_GETTABUP: // R(A) := UpValue[B][RK(C)]
+		a, _, c := i.ABC()
+		useRK(c)
+		e.Defs.Add(a)
+	case OP_GETTABLE: // R(A) := R(B)[RK(C)]
+		a, b, c := i.ABC()
+		e.Uses.Add(b)
+		useRK(c)
+		e.Defs.Add(a)
+	case OP_SETTABUP: // UpValue[A][RK(B)] := RK(C)
+		_, b, c := i.ABC()
+		useRK(b)
+		useRK(c)
+	case OP_SETUPVAL: // UpValue[B] := R(A)
+		a, _, _ := i.ABC()
+		e.Uses.Add(a)
+	case OP_SETTABLE: // R(A)[RK(B)] := RK(C)
+		a, b, c := i.ABC()
+		e.Uses.Add(a)
+		useRK(b)
+		useRK(c)
+	case OP_SELF: // R(A+1) := R(B); R(A) := R(B)[RK(C)]
+		a, b, c := i.ABC()
+		e.Uses.Add(b)
+		useRK(c)
+		e.Defs.AddRange(a, a+1)
+	case OP_ADD, OP_SUB, OP_MUL, OP_MOD, OP_POW, OP_DIV, OP_IDIV,
+		OP_BAND, OP_BOR, OP_BXOR, OP_SHL, OP_SHR: // R(A) := RK(B) op RK(C)
+		a, b, c := i.ABC()
+		useRK(b)
+		useRK(c)
+		e.Defs.Add(a)
+	case OP_CONCAT: // R(A) := R(B).. ... ..R(C)
+		a, b, c := i.ABC()
+		e.Uses.AddRange(b, c)
+		e.Defs.Add(a)
+		e.Clobbers.AddRange(b, c) // 拼接时中间结果写回R(B)～R(C)，数值也会被就地转换为字符串
+		e.Clobbers = e.Clobbers.Minus(e.Defs)
+	case OP_EQ, OP_LT, OP_LE: // if ((RK(B) op RK(C)) ~= A) then pc++
+		_, b, c := i.ABC()
+		useRK(b)
+		useRK(c)
+	case OP_TEST: // if not (R(A) <=> C) then pc++
+		a, _, _ := i.ABC()
+		e.Uses.Add(a)
+	case OP_TESTSET: // if (R(B) <=> C) then R(A) := R(B) else pc++
+		a, b, _ := i.ABC()
+		e.Uses.Add(b)
+		e.MayDefs.Add(a)
+	case OP_CALL: // R(A), ... ,R(A+C-2) := R(A)(R(A+1), ... ,R(A+B-1))
+		a, b, c := i.ABC()
+		useArgs(&e.Uses, a, b, top)
+		if c == 0 { // 返回值一直到栈顶，之后的寄存器是被调用函数留下的无意义值
+			e.MayDefs.AddRange(a, top)
+			e.Clobbers.AddRange(a, top)
+		} else {
+			e.Defs.AddRange(a, a+c-2)
+			e.Clobbers.AddRange(a+c-1, top)
+		}
+	case OP_TAILCALL: // return R(A)(R(A+1), ... ,R(A+B-1))，调用Go函数时返回值从R(A)开始，交给下一条RETURN
+		a, b, _ := i.ABC()
+		useArgs(&e.Uses, a, b, top)
+		e.MayDefs.AddRange(a, top)
+		e.Clobbers.AddRange(a, top)
+	case OP_RETURN: // return R(A), ... ,R(A+B-2)
+		a, b, _ := i.ABC()
+		if b == 0 {
+			e.Uses.AddRange(a, top)
+		} else {
+			e.Uses.AddRange(a, a+b-2)
+		}
+	case OP_FORLOOP: // R(A)+=R(A+2); if R(A) <?= R(A+1) then { pc+=sBx; R(A+3)=R(A) }
+		a, _ := i.AsBx()
+		e.Uses.AddRange(a, a+2)
+		e.Defs.Add(a)
+		e.MayDefs.Add(a + 3)
+	case OP_FORPREP: // R(A)-=R(A+2); pc+=sBx（同时把初值、限制、步长转换为数值）
+		a, _ := i.AsBx()
+		e.Uses.AddRange(a, a+2)
+		e.Defs.AddRange(a, a+2)
+	case OP_TFORCALL: // R(A+3), ... ,R(A+2+C) := R(A)(R(A+1), R(A+2))
+		a, _, c := i.ABC()
+		e.Uses.AddRange(a, a+2)
+		e.Defs.AddRange(a+3, a+2+c)
+		e.Clobbers.AddRange(a+3+c, top) // 迭代器的栈帧从R(A+4)开始
+	case OP_TFORLOOP: // if R(A+1) ~= nil then { R(A)=R(A+1); pc += sBx }
+		a, _ := i.AsBx()
+		e.Uses.Add(a + 1)
+		e.MayDefs.Add(a)
+	case OP_SETLIST: // R(A)[(C-1)*FPF+i] := R(A+i), 1 <= i <= B
+		a, b, _ := i.ABC()
+		if b == 0 {
+			e.Uses.AddRange(a, top)
+		} else {
+			e.Uses.AddRange(a, a+b)
+		}
+	case OP_CLOSURE: // R(A) := closure(KPROTO[Bx])，同时捕获当前函数栈上的局部变量
+		a, bx := i.ABx()
+		if bx < len(proto.Protos) {
+			for _, uv := range proto.Protos[bx].Upvalues {
+				if uv.Instack == 1 {
+					e.Uses.Add(int(uv.Idx))
+				}
+			}
+		}
+		e.Defs.Add(a)
+	case OP_VARARG: // R(A), R(A+1), ..., R(A+B-2) = vararg
+		a, b, _ := i.ABC()
+		if b == 0 {
+			e.MayDefs.AddRange(a, top)
+		} else {
+			e.Defs.AddRange(a, a+b-2)
+		}
+	}
+	return e
+}
+
+// branchDef 有些指令只在走向特定后继时才写入寄存器：FORLOOP继续循环时写入R(A+3)，
+// TFORLOOP继续循环时写入R(A)，TESTSET条件成立（不跳过下一条指令）时写入R(A)
+// 返回写入的寄存器以及对应的后继pc（这些寄存器同时也记在InstEffect的MayDefs中）
+func branchDef(i Instruction, pc int) (reg, succ int, ok bool) {
+	switch i.Opcode() {
+	case OP_FORLOOP:
+		a, _ := i.AsBx()
+		target, _ := JumpTarget(i, pc)
+		return a + 3, target, true
+	case OP_TFORLOOP:
+		a, _ := i.AsBx()
+		target, _ := JumpTarget(i, pc)
+		return a, target, true
+	case OP_TESTSET:
+		a, _, _ := i.ABC()
+		return a, pc + 1, true
+	default:
+		return 0, 0, false
+	}
+}
+
+// useArgs CALL/TAILCALL读取函数R(A)和参数R(A+1)～R(A+B-1)，B为0时参数一直到栈顶
+func useArgs(uses *RegSet, a, b, top int) {
+	uses.Add(a)
+	if b == 0 {
+		uses.AddRange(a+1, top)
+	} else {
+		uses.AddRange(a+1, a+b-1)
+	}
+}
@@ -1,6 +1,8 @@
 // vm/instruction.go
 package vm
 
+import "fmt"
+
 // 指令操作数最大值定义（Lua 5.3字节码规范）
 const (
 	MAXARG_Bx  = 1<<18 - 1      // Bx操作数最大值（无符号18位）：262143
@@ -31,8 +33,8 @@ func (self Instruction) Opcode() int {
 // ABC 从IABC模式指令中提取A/B/C三个操作数
 func (self Instruction) ABC() (a, b, c int) {
 	a = int(self >> 6 & 0xFF)   // A：6-13位（8位），0xFF掩码提取
-	b = int(self >> 14 & 0x1FF) // B：14-22位（9位），0x1FF掩码提取
-	c = int(self >> 23 & 0x1FF) // C：23-31位（9位），0x1FF掩码提取（注：原代码b重复赋值，已修正为c）
+	c = int(self >> 14 & 0x1FF) // C：14-22位（9位），0x1FF掩码提取
+	b = int(self >> 23 & 0x1FF) // B：23-31位（9位），0x1FF掩码提取
 	return
 }
 
@@ -73,3 +75,61 @@ func (self Instruction) BMode() byte {
 func (self Instruction) CMode() byte {
 	return opcodes[self.Opcode()].argCMode
 }
+
+// TestFlag 判断是否为条件测试指令（EQ/LT/LE/TEST/TESTSET），这类指令根据结果决定是否跳过下一条指令
+func (self Instruction) TestFlag() bool {
+	return opcodes[self.Opcode()].testFlag == 1
+}
+
+// Operands 按luac -l的格式返回指令的操作数（如"0 -1"），常量（RK操作数及LOADK等的Bx）用负数表示
+func (self Instruction) Operands() string {
+	switch self.OpMode() {
+	case IABC:
+		a, b, c := self.ABC()
+		s := fmt.Sprintf("%d", a)
+		if self.BMode() != OpArgN {
+			s += fmt.Sprintf(" %d", rkOperand(b))
+		}
+		if self.CMode() != OpArgN {
+			s += fmt.Sprintf(" %d", rkOperand(c))
+		}
+		return s
+	case IABx:
+		a, bx := self.ABx()
+		s := fmt.Sprintf("%d", a)
+		if self.BMode() == OpArgK {
+			s += fmt.Sprintf(" %d", -1-bx)
+		} else if self.BMode() == OpArgU {
+			s += fmt.Sprintf(" %d", bx)
+		}
+		return s
+	case IAsBx:
+		a, sbx := self.AsBx()
+		return fmt.Sprintf("%d %d", a, sbx)
+	default: // IAx
+		return fmt.Sprintf("%d", -1-self.Ax())
+	}
+}
+
+// rkOperand RK操作数大于0xFF时表示常量，按luac -l的习惯显示为负数
+func rkOperand(rk int) int {
+	if rk > 0xFF {
+		return -1 - rk&0xFF
+	}
+	return rk
+}
+
+// CreateABC 按IABC模式编码指令（ABC的逆操作）
+func CreateABC(op, a, b, c int) Instruction {
+	return Instruction(op | a<<6 | c<<14 | b<<23)
+}
+
+// CreateABx 按IABx模式编码指令（ABx的逆操作）
+func CreateABx(op, a, bx int) Instruction {
+	return Instruction(op | a<<6 | bx<<14)
+}
+
+// CreateAsBx 按IAsBx模式编码指令（AsBx的逆操作）
+func CreateAsBx(op, a, sbx int) Instruction {
+	return CreateABx(op, a, sbx+MAXARG_sBx)
+}
@@ -0,0 +1,47 @@
+package vm
+
+import (
+	"LuaLight/binchunk"
+	"os"
+	"strings"
+	"testing"
+)
+
+// 仓库自带的luac.out由hello_world.lua编译而来，luac -l的输出为：
+//
+//	1	[1]	GETTABUP 	0 0 -1
+//	2	[1]	LOADK    	1 -2
+//	3	[1]	CALL     	0 2 1
+//	4	[1]	RETURN   	0 1
+func TestDecodeLuac(t *testing.T) {
+	data, err := os.ReadFile("../luac.out")
+	if err != nil {
+		t.Fatal(err)
+	}
+	proto := binchunk.Undump(data)
+	want := []struct {
+		name    string
+		a, b, c int
+	}{
+		{"GETTABUP", 0, 0, 0x100},
+		{"LOADK", 1, 1, 0}, // IABx：b为Bx
+		{"CALL", 0, 2, 1},
+		{"RETURN", 0, 1, 0},
+	}
+	if len(proto.Code) != len(want) {
+		t.Fatalf("%d instructions, want %d", len(proto.Code), len(want))
+	}
+	for pc, w := range want {
+		i := Instruction(proto.Code[pc])
+		var a, b, c int
+		if i.OpMode() == IABC {
+			a, b, c = i.ABC()
+		} else {
+			a, b = i.ABx()
+		}
+		if name := strings.TrimSpace(i.OpName()); name != w.name || a != w.a || b != w.b || c != w.c {
+			t.Errorf("pc %d: %s %d %d %d, want %s %d %d %d",
+				pc, name, a, b, c, w.name, w.a, w.b, w.c)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+// LuaLight/vm/opt/fold.go
+package opt
+
+// 常量折叠：两个操作数都是常量的算术/按位运算指令，在优化时直接算出结果，替换为LOADK
+// 运算本身交给state.Arith完成，保证结果与运行时完全一致
+
+import (
+	. "LuaLight/api"
+	"LuaLight/state"
+	. "LuaLight/vm"
+	"math"
+)
+
+// foldConstants 折叠R(A) := RK(B) op RK(C)中B、C都是数值常量的指令（ADD～SHR）
+func (self *funcState) foldConstants() {
+	var ls LuaState // 用于计算的虚拟机，需要时才创建
+	for pc := range self.proto.Code {
+		i := self.inst(pc)
+		op := i.Opcode()
+		if op < OP_ADD || op > OP_SHR {
+			continue
+		}
+		a, b, c := i.ABC()
+		if !isK(b) || !isK(c) {
+			continue
+		}
+		v1, v2 := self.proto.Constants[indexK(b)], self.proto.Constants[indexK(c)]
+		arithOp := ArithOp(op - OP_ADD) // ADD～SHR与LUA_OPADD～LUA_OPSHR顺序一致
+		if !isNumeral(v1) || !isNumeral(v2) || !validOp(arithOp, v1, v2) {
+			continue
+		}
+
+		if ls == nil {
+			ls = state.New()
+		}
+		result := arith(ls, arithOp, v1, v2)
+		if f, ok := result.(float64); ok && (math.IsNaN(f) || f == 0) {
+			continue // 与官方编译器一致：不折叠结果为NaN或0.0（可能是-0.0）的浮点运算
+		}
+		if k := self.constant(result); k >= 0 {
+			self.setInst(pc, CreateABx(OP_LOADK, a, k))
+		}
+	}
+}
+
+// arith 在ls上计算v1 op v2，返回结果（int64或float64）
+func arith(ls LuaState, op ArithOp, v1, v2 interface{}) interface{} {
+	ls.PushAny(v1)
+	ls.PushAny(v2)
+	ls.Arith(op)
+	result := ls.ToAny(-1)
+	ls.Pop(1)
+	return result
+}
+
+// validOp 判断运算能否在编译期安全地完成（对应官方lcode.c的validop）
+// 按位运算要求操作数能转换为整数；除法、整除、取模要求除数不为0
+func validOp(op ArithOp, v1, v2 interface{}) bool {
+	switch op {
+	case LUA_OPBAND, LUA_OPBOR, LUA_OPBXOR, LUA_OPSHL, LUA_OPSHR:
+		_, ok1 := toInteger(v1)
+		_, ok2 := toInteger(v2)
+		return ok1 && ok2
+	case LUA_OPDIV, LUA_OPIDIV, LUA_OPMOD:
+		switch x := v2.(type) {
+		case int64:
+			return x != 0
+		case float64:
+			return x != 0
+		}
+		return false
+	default:
+		return true
+	}
+}
+
+// toInteger 数值常量转换为整数（浮点数必须没有小数部分）
+func toInteger(v interface{}) (int64, bool) {
+	switch x := v.(type) {
+	case int64:
+		return x, true
+	case float64:
+		if i := int64(x); float64(i) == x {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// isNumeral 判断常量是否为数值（字符串虽然能参与算术运算，但不做折叠）
+func isNumeral(v interface{}) bool {
+	switch v.(type) {
+	case int64, float64:
+		return true
+	default:
+		return false
+	}
+}
+
+// constant 返回常量v在常量表中的索引，不存在时追加到常量表末尾
+// 常量表已满（索引超出LOADK的Bx范围）时返回-1
+func (self *funcState) constant(v interface{}) int {
+	for k, c := range self.proto.Constants {
+		if sameConstant(c, v) {
+			return k
+		}
+	}
+	k := len(self.proto.Constants)
+	if k > MAXARG_Bx {
+		return -1
+	}
+	self.proto.Constants = append(self.proto.Constants, v)
+	return k
+}
+
+// sameConstant 判断两个常量是否完全相同（类型相同且值相同，浮点数按位比较）
+func sameConstant(c, v interface{}) bool {
+	switch x := c.(type) {
+	case int64:
+		y, ok := v.(int64)
+		return ok && x == y
+	case float64:
+		y, ok := v.(float64)
+		return ok && math.Float64bits(x) == math.Float64bits(y)
+	default:
+		return false
+	}
+}
+
+// isK 判断RK操作数是否表示常量（最高位为1）
+func isK(rk int) bool {
+	return rk > 0xFF
+}
+
+// indexK 取出RK操作数表示的常量索引
+func indexK(rk int) int {
+	return rk & 0xFF
+}
@@ -0,0 +1,239 @@
+// LuaLight/vm/opt/opt.go
+package opt
+
+// 字节码优化器：直接在函数原型（binchunk.Prototype）上做窥孔优化
+// 包含常量折叠、冗余MOVE消除、LOADNIL合并、跳转串联（JMP到JMP）、不可达代码删除；
+// 删除指令后统一修正跳转偏移、行号表（LineInfo）和局部变量的有效范围（LocVars）
+
+import (
+	"LuaLight/binchunk"
+	. "LuaLight/vm"
+	"LuaLight/vm/cfg"
+)
+
+// Optimize 优化函数原型及其所有子函数（直接修改proto）
+func Optimize(proto *binchunk.Prototype) {
+	// 删除指令后可能出现新的优化机会（如跳到下一条指令的JMP），反复执行直到指令数不再变化
+	for {
+		n := len(proto.Code)
+		f := newFuncState(proto)
+		f.foldConstants()
+		f.removeRedundantMoves()
+		f.mergeLoadNils()
+		f.threadJumps()
+		f.removeUnreachable()
+		f.compact()
+		if len(proto.Code) == n {
+			break
+		}
+	}
+
+	for _, p := range proto.Protos {
+		Optimize(p)
+	}
+}
+
+// funcState 单个函数原型的优化状态
+type funcState struct {
+	proto  *binchunk.Prototype
+	dead   []bool // 标记要删除的指令
+	labels []bool // 标记会被跳转到的指令（跳转目标、条件测试跳过下一条指令后到达的位置）
+}
+
+func newFuncState(proto *binchunk.Prototype) *funcState {
+	f := &funcState{
+		proto: proto,
+		dead:  make([]bool, len(proto.Code)),
+	}
+	f.findLabels()
+	return f
+}
+
+// inst 返回pc处的指令
+func (self *funcState) inst(pc int) Instruction {
+	return Instruction(self.proto.Code[pc])
+}
+
+// setInst 修改pc处的指令
+func (self *funcState) setInst(pc int, i Instruction) {
+	self.proto.Code[pc] = uint32(i)
+}
+
+// findLabels 找出所有会被跳转到的指令
+func (self *funcState) findLabels() {
+	code := self.proto.Code
+	self.labels = make([]bool, len(code)+1)
+	for pc := range code {
+		if target, ok := self.jumpTarget(pc); ok && target >= 0 && target <= len(code) {
+			self.labels[target] = true
+		}
+		if self.skipsNext(pc) && pc+2 <= len(code) {
+			self.labels[pc+2] = true
+		}
+	}
+}
+
+// jumpTarget 对于带跳转偏移的指令（JMP/FORPREP/FORLOOP/TFORLOOP），返回其跳转目标
+func (self *funcState) jumpTarget(pc int) (int, bool) {
+	return cfg.JumpTarget(self.inst(pc), pc)
+}
+
+// skipsNext 判断pc处的指令是否可能跳过下一条指令
+func (self *funcState) skipsNext(pc int) bool {
+	return cfg.SkipsNext(self.inst(pc))
+}
+
+// isSkipSlot 判断pc处的指令是否紧跟在会跳过下一条指令的指令之后
+// 这样的指令不能随意删除或与其他指令合并，否则会改变“跳过”的对象
+func (self *funcState) isSkipSlot(pc int) bool {
+	return pc > 0 && self.skipsNext(pc-1)
+}
+
+// removeRedundantMoves 删除冗余的MOVE：
+// 1. MOVE A A（自己赋值给自己）；
+// 2. MOVE A B紧跟MOVE B A（第二条不会改变任何值）
+func (self *funcState) removeRedundantMoves() {
+	for pc := range self.proto.Code {
+		i := self.inst(pc)
+		if i.Opcode() != OP_MOVE || self.isSkipSlot(pc) {
+			continue
+		}
+		a, b, _ := i.ABC()
+		if a == b {
+			self.dead[pc] = true
+			continue
+		}
+		if pc+1 < len(self.proto.Code) && !self.labels[pc+1] && !self.dead[pc+1] {
+			next := self.inst(pc + 1)
+			if next.Opcode() == OP_MOVE {
+				a2, b2, _ := next.ABC()
+				if a2 == b && b2 == a {
+					self.dead[pc+1] = true
+				}
+			}
+		}
+	}
+}
+
+// mergeLoadNils 合并相邻（或重叠）寄存器范围的连续LOADNIL指令
+// LOADNIL A B表示R(A)到R(A+B)置为nil
+func (self *funcState) mergeLoadNils() {
+	last := -1 // 最近一条可以与后续指令合并的LOADNIL（与pc之间只隔着已合并掉的LOADNIL）
+	for pc := range self.proto.Code {
+		i := self.inst(pc)
+		if i.Opcode() != OP_LOADNIL || self.dead[pc] {
+			last = -1
+			continue
+		}
+		if last >= 0 && !self.labels[pc] {
+			a1, b1, _ := self.inst(last).ABC()
+			a2, b2, _ := i.ABC()
+			from1, to1 := a1, a1+b1
+			from2, to2 := a2, a2+b2
+			if from2 <= to1+1 && from1 <= to2+1 { // 两个范围相邻或重叠
+				from, to := min(from1, from2), max(to1, to2)
+				self.setInst(last, CreateABC(OP_LOADNIL, from, to-from, 0))
+				self.dead[pc] = true
+				continue
+			}
+		}
+		if self.isSkipSlot(pc) {
+			last = -1 // 可能被跳过的LOADNIL不能与下一条合并
+		} else {
+			last = pc
+		}
+	}
+}
+
+// threadJumps 跳转串联：JMP的目标如果是另一条JMP（且该JMP不需要关闭upvalue），直接跳到最终目标；
+// 串联后偏移为0的JMP（跳到下一条指令）等价于空操作，删除
+func (self *funcState) threadJumps() {
+	code := self.proto.Code
+	for pc := range code {
+		i := self.inst(pc)
+		if i.Opcode() != OP_JMP {
+			continue
+		}
+		a, _ := i.AsBx()
+		target, _ := self.jumpTarget(pc)
+		for steps := 0; steps < len(code) && target < len(code); steps++ {
+			next := self.inst(target)
+			if next.Opcode() != OP_JMP || target == pc {
+				break
+			}
+			if a2, _ := next.AsBx(); a2 != 0 {
+				break // 中间的JMP还要关闭upvalue，不能跳过
+			}
+			target, _ = self.jumpTarget(target)
+		}
+		self.setInst(pc, CreateAsBx(OP_JMP, a, target-pc-1))
+		if target == pc+1 && a == 0 && !self.isSkipSlot(pc) {
+			self.dead[pc] = true
+		}
+	}
+	self.findLabels() // 跳转目标变了，重新计算
+}
+
+// removeUnreachable 删除从入口出发沿控制流无法到达的基本块中的指令（如RETURN之后的死代码）
+// 紧跟在条件测试或LOADBOOL之后的指令即使不可达也要保留（如luac为`(a < b) and c`生成的
+// LOADBOOL A 0 1之后的那条指令），否则“跳过下一条指令”会跳过原本的下一条可达指令
+func (self *funcState) removeUnreachable() {
+	g := cfg.Build(self.proto)
+	for _, b := range g.Blocks {
+		if b.Reachable {
+			continue
+		}
+		for pc := b.Start; pc < b.End; pc++ {
+			if self.isSkipSlot(pc) {
+				continue
+			}
+			self.dead[pc] = true
+		}
+	}
+}
+
+// compact 真正删除被标记的指令，并修正跳转偏移、行号表和局部变量的有效范围
+func (self *funcState) compact() {
+	proto := self.proto
+	n := len(proto.Code)
+
+	// newIndex[pc]：原来第pc条指令删除后的新位置（被删除的指令对应其后第一条保留的指令）
+	newIndex := make([]int, n+1)
+	count := 0
+	for pc := 0; pc < n; pc++ {
+		newIndex[pc] = count
+		if !self.dead[pc] {
+			count++
+		}
+	}
+	newIndex[n] = count
+	if count == n {
+		return // 没有要删除的指令
+	}
+
+	code := make([]uint32, 0, count)
+	var lineInfo []uint32
+	for pc := 0; pc < n; pc++ {
+		if self.dead[pc] {
+			continue
+		}
+		i := self.inst(pc)
+		if target, ok := self.jumpTarget(pc); ok {
+			a, _ := i.AsBx()
+			i = CreateAsBx(i.Opcode(), a, newIndex[target]-newIndex[pc]-1)
+		}
+		code = append(code, uint32(i))
+		if pc < len(proto.LineInfo) {
+			lineInfo = append(lineInfo, proto.LineInfo[pc])
+		}
+	}
+	proto.Code = code
+	if len(proto.LineInfo) > 0 {
+		proto.LineInfo = lineInfo
+	}
+	for i := range proto.LocVars {
+		v := &proto.LocVars[i]
+		v.StartPC = uint32(newIndex[min(int(v.StartPC), n)])
+		v.EndPC = uint32(newIndex[min(int(v.EndPC), n)])
+	}
+}
@@ -0,0 +1,372 @@
+package opt
+
+import (
+	"LuaLight/binchunk"
+	. "LuaLight/vm"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// k 把常量索引编码为RK操作数
+func k(i int) int {
+	return 0x100 | i
+}
+
+// fn 测试用的函数原型片段：优化前或优化后的指令、行号和局部变量
+type fn struct {
+	code      []Instruction
+	lines     []uint32
+	locVars   []binchunk.LocVar
+	constants []interface{}
+}
+
+func (self fn) proto() *binchunk.Prototype {
+	p := &binchunk.Prototype{
+		Source:       "@t.lua",
+		MaxStackSize: 4,
+		LineInfo:     append([]uint32(nil), self.lines...),
+		LocVars:      append([]binchunk.LocVar(nil), self.locVars...),
+		Constants:    append([]interface{}(nil), self.constants...),
+	}
+	for _, i := range self.code {
+		p.Code = append(p.Code, uint32(i))
+	}
+	return p
+}
+
+// check 比较优化结果；want中没有给出常量表时不比较常量表
+func check(t *testing.T, got *binchunk.Prototype, want fn) {
+	t.Helper()
+	if !reflect.DeepEqual(got.Code, want.proto().Code) {
+		t.Errorf("Code:\n%s\nwant:\n%s", listing(got.Code), listing(want.proto().Code))
+	}
+	if !reflect.DeepEqual(got.LineInfo, want.proto().LineInfo) {
+		t.Errorf("LineInfo = %v, want %v", got.LineInfo, want.lines)
+	}
+	if !reflect.DeepEqual(got.LocVars, want.proto().LocVars) {
+		t.Errorf("LocVars = %v, want %v", got.LocVars, want.locVars)
+	}
+	if want.constants != nil && !reflect.DeepEqual(got.Constants, want.constants) {
+		t.Errorf("Constants = %v, want %v", got.Constants, want.constants)
+	}
+}
+
+// listing 把指令列表格式化为便于对比的文本
+func listing(code []uint32) string {
+	var sb strings.Builder
+	for pc, c := range code {
+		i := Instruction(c)
+		fmt.Fprintf(&sb, "\t%d %-9s", pc, i.OpName())
+		switch i.OpMode() {
+		case IABC:
+			a, b, c := i.ABC()
+			fmt.Fprintf(&sb, "%d %d %d\n", a, b, c)
+		case IABx:
+			a, bx := i.ABx()
+			fmt.Fprintf(&sb, "%d %d\n", a, bx)
+		case IAsBx:
+			a, sbx := i.AsBx()
+			fmt.Fprintf(&sb, "%d %d\n", a, sbx)
+		case IAx:
+			fmt.Fprintf(&sb, "%d\n", i.Ax())
+		}
+	}
+	return sb.String()
+}
+
+func TestOptimize(t *testing.T) {
+	tests := []struct {
+		name   string
+		before fn
+		after  fn
+	}{
+		{
+			name: "fold integer add",
+			before: fn{
+				code: []Instruction{
+					CreateABC(OP_ADD, 0, k(0), k(1)),
+					CreateABC(OP_RETURN, 0, 2, 0),
+				},
+				lines:     []uint32{1, 1},
+				constants: []interface{}{int64(1), int64(2)},
+			},
+			after: fn{
+				code: []Instruction{
+					CreateABx(OP_LOADK, 0, 2),
+					CreateABC(OP_RETURN, 0, 2, 0),
+				},
+				lines:     []uint32{1, 1},
+				constants: []interface{}{int64(1), int64(2), int64(3)},
+			},
+		},
+		{
+			name: "fold reuses existing constant",
+			before: fn{
+				code: []Instruction{
+					CreateABC(OP_MUL, 0, k(0), k(1)),
+					CreateABC(OP_RETURN, 0, 2, 0),
+				},
+				lines:     []uint32{1, 1},
+				constants: []interface{}{2.0, 1.5, 3.0},
+			},
+			after: fn{
+				code: []Instruction{
+					CreateABx(OP_LOADK, 0, 2),
+					CreateABC(OP_RETURN, 0, 2, 0),
+				},
+				lines:     []uint32{1, 1},
+				constants: []interface{}{2.0, 1.5, 3.0},
+			},
+		},
+		{
+			name: "no fold of division by zero or non-integral bitwise",
+			before: fn{
+				code: []Instruction{
+					CreateABC(OP_IDIV, 0, k(0), k(1)),
+					CreateABC(OP_BAND, 1, k(2), k(0)),
+					CreateABC(OP_RETURN, 0, 3, 0),
+				},
+				lines:     []uint32{1, 2, 3},
+				constants: []interface{}{int64(1), int64(0), 1.5},
+			},
+			after: fn{
+				code: []Instruction{
+					CreateABC(OP_IDIV, 0, k(0), k(1)),
+					CreateABC(OP_BAND, 1, k(2), k(0)),
+					CreateABC(OP_RETURN, 0, 3, 0),
+				},
+				lines:     []uint32{1, 2, 3},
+				constants: []interface{}{int64(1), int64(0), 1.5},
+			},
+		},
+		{
+			name: "redundant moves",
+			before: fn{
+				code: []Instruction{
+					CreateABC(OP_MOVE, 0, 0, 0),
+					CreateABC(OP_MOVE, 1, 0, 0),
+					CreateABC(OP_MOVE, 0, 1, 0),
+					CreateABC(OP_RETURN, 0, 3, 0),
+				},
+				lines:   []uint32{1, 2, 3, 4},
+				locVars: []binchunk.LocVar{{VarName: "x", StartPC: 1, EndPC: 4}},
+			},
+			after: fn{
+				code: []Instruction{
+					CreateABC(OP_MOVE, 1, 0, 0),
+					CreateABC(OP_RETURN, 0, 3, 0),
+				},
+				lines:   []uint32{2, 4},
+				locVars: []binchunk.LocVar{{VarName: "x", StartPC: 0, EndPC: 2}},
+			},
+		},
+		{
+			name: "merge adjacent LOADNILs",
+			before: fn{
+				code: []Instruction{
+					CreateABC(OP_LOADNIL, 0, 1, 0),
+					CreateABC(OP_LOADNIL, 2, 0, 0),
+					CreateABC(OP_LOADNIL, 1, 2, 0),
+					CreateABC(OP_RETURN, 0, 1, 0),
+				},
+				lines: []uint32{1, 2, 3, 4},
+			},
+			after: fn{
+				code: []Instruction{
+					CreateABC(OP_LOADNIL, 0, 3, 0),
+					CreateABC(OP_RETURN, 0, 1, 0),
+				},
+				lines: []uint32{1, 4},
+			},
+		},
+		{
+			name: "no LOADNIL merge across a jump target",
+			before: fn{
+				code: []Instruction{
+					CreateABC(OP_TEST, 0, 0, 0),
+					CreateAsBx(OP_JMP, 0, 1),
+					CreateABC(OP_LOADNIL, 1, 0, 0),
+					CreateABC(OP_LOADNIL, 2, 0, 0),
+					CreateABC(OP_RETURN, 0, 1, 0),
+				},
+				lines: []uint32{1, 1, 2, 3, 4},
+			},
+			after: fn{
+				code: []Instruction{
+					CreateABC(OP_TEST, 0, 0, 0),
+					CreateAsBx(OP_JMP, 0, 1),
+					CreateABC(OP_LOADNIL, 1, 0, 0),
+					CreateABC(OP_LOADNIL, 2, 0, 0),
+					CreateABC(OP_RETURN, 0, 1, 0),
+				},
+				lines: []uint32{1, 1, 2, 3, 4},
+			},
+		},
+		{
+			name: "thread jump to jump",
+			before: fn{
+				code: []Instruction{
+					CreateABC(OP_TEST, 0, 0, 0),
+					CreateAsBx(OP_JMP, 0, 2), // → 4
+					CreateABC(OP_LOADK, 1, 0, 0),
+					CreateABC(OP_RETURN, 1, 2, 0),
+					CreateAsBx(OP_JMP, 0, 1), // → 6
+					CreateABC(OP_LOADK, 1, 0, 0),
+					CreateABC(OP_RETURN, 0, 1, 0),
+				},
+				lines: []uint32{1, 1, 2, 2, 3, 4, 5},
+			},
+			after: fn{
+				code: []Instruction{
+					CreateABC(OP_TEST, 0, 0, 0),
+					CreateAsBx(OP_JMP, 0, 2), // → 4
+					CreateABC(OP_LOADK, 1, 0, 0),
+					CreateABC(OP_RETURN, 1, 2, 0),
+					CreateABC(OP_RETURN, 0, 1, 0),
+				},
+				lines: []uint32{1, 1, 2, 2, 5},
+			},
+		},
+		{
+			name: "no threading through a JMP that closes upvalues",
+			before: fn{
+				code: []Instruction{
+					CreateAsBx(OP_JMP, 0, 0), // → 1
+					CreateAsBx(OP_JMP, 1, 0), // → 2，关闭R(0)及以上的upvalue
+					CreateABC(OP_RETURN, 0, 1, 0),
+				},
+				lines: []uint32{1, 2, 3},
+			},
+			after: fn{
+				code: []Instruction{
+					CreateAsBx(OP_JMP, 1, 0),
+					CreateABC(OP_RETURN, 0, 1, 0),
+				},
+				lines: []uint32{2, 3},
+			},
+		},
+		{
+			name: "remove code after RETURN",
+			before: fn{
+				code: []Instruction{
+					CreateABC(OP_LOADK, 0, 0, 0),
+					CreateABC(OP_RETURN, 0, 2, 0),
+					CreateABC(OP_MOVE, 1, 0, 0),
+					CreateABC(OP_RETURN, 0, 1, 0),
+				},
+				lines:   []uint32{1, 2, 3, 4},
+				locVars: []binchunk.LocVar{{VarName: "x", StartPC: 1, EndPC: 4}},
+			},
+			after: fn{
+				code: []Instruction{
+					CreateABC(OP_LOADK, 0, 0, 0),
+					CreateABC(OP_RETURN, 0, 2, 0),
+				},
+				lines:   []uint32{1, 2},
+				locVars: []binchunk.LocVar{{VarName: "x", StartPC: 1, EndPC: 2}},
+			},
+		},
+		{
+			name: "jump offsets fixed after deletion",
+			before: fn{
+				code: []Instruction{
+					CreateAsBx(OP_FORPREP, 0, 1), // → 2
+					CreateABC(OP_MOVE, 3, 3, 0),
+					CreateAsBx(OP_FORLOOP, 0, -2), // → 1
+					CreateABC(OP_RETURN, 0, 1, 0),
+				},
+				lines: []uint32{1, 2, 1, 3},
+			},
+			after: fn{
+				code: []Instruction{
+					CreateAsBx(OP_FORPREP, 0, 0),  // → 1
+					CreateAsBx(OP_FORLOOP, 0, -1), // → 1
+					CreateABC(OP_RETURN, 0, 1, 0),
+				},
+				lines: []uint32{1, 1, 3},
+			},
+		},
+		{
+			// local x = (a < b) and c：LOADBOOL 2 0 1之后的指令不可达，但必须保留，
+			// 否则LOADBOOL会跳过MOVE
+			name: "keep unreachable LOADBOOL skip slot",
+			before: fn{
+				code: []Instruction{
+					CreateABC(OP_LOADBOOL, 2, 0, 1),
+					CreateABC(OP_LOADBOOL, 2, 1, 0),
+					CreateABC(OP_MOVE, 1, 2, 0),
+					CreateABC(OP_RETURN, 0, 1, 0),
+				},
+				lines: []uint32{1, 1, 1, 2},
+			},
+			after: fn{
+				code: []Instruction{
+					CreateABC(OP_LOADBOOL, 2, 0, 1),
+					CreateABC(OP_LOADBOOL, 2, 1, 0),
+					CreateABC(OP_MOVE, 1, 2, 0),
+					CreateABC(OP_RETURN, 0, 1, 0),
+				},
+				lines: []uint32{1, 1, 1, 2},
+			},
+		},
+		{
+			// 条件测试之后的JMP即使跳到下一条指令也不能删除，MOVE A A同理
+			name: "keep instructions in a test skip slot",
+			before: fn{
+				code: []Instruction{
+					CreateABC(OP_EQ, 0, 0, k(0)),
+					CreateAsBx(OP_JMP, 0, 0),
+					CreateABC(OP_TEST, 1, 0, 0),
+					CreateABC(OP_MOVE, 1, 1, 0),
+					CreateABC(OP_RETURN, 0, 1, 0),
+				},
+				lines:     []uint32{1, 1, 2, 2, 3},
+				constants: []interface{}{int64(0)},
+			},
+			after: fn{
+				code: []Instruction{
+					CreateABC(OP_EQ, 0, 0, k(0)),
+					CreateAsBx(OP_JMP, 0, 0),
+					CreateABC(OP_TEST, 1, 0, 0),
+					CreateABC(OP_MOVE, 1, 1, 0),
+					CreateABC(OP_RETURN, 0, 1, 0),
+				},
+				lines: []uint32{1, 1, 2, 2, 3},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := tt.before.proto()
+			Optimize(p)
+			check(t, p, tt.after)
+		})
+	}
+}
+
+func TestOptimizeSubprotos(t *testing.T) {
+	sub := fn{
+		code: []Instruction{
+			CreateABC(OP_MOVE, 0, 0, 0),
+			CreateABC(OP_RETURN, 0, 1, 0),
+		},
+		lines: []uint32{2, 3},
+	}.proto()
+	main := fn{
+		code: []Instruction{
+			CreateABx(OP_CLOSURE, 0, 0),
+			CreateABC(OP_RETURN, 0, 1, 0),
+		},
+		lines: []uint32{3, 3},
+	}.proto()
+	main.Protos = []*binchunk.Prototype{sub}
+
+	Optimize(main)
+	check(t, sub, fn{
+		code:  []Instruction{CreateABC(OP_RETURN, 0, 1, 0)},
+		lines: []uint32{3},
+	})
+}